@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for calls to an upstream whose breaker is open, no request is sent.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "CLOSED"
+	BreakerOpen     BreakerState = "OPEN"
+	BreakerHalfOpen BreakerState = "HALF_OPEN"
+)
+
+type BreakerConfig struct {
+	// FailureThreshold is how many calls in a row have to fail to open the breaker.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker rejects calls before a probe is let through.
+	OpenTimeout time.Duration
+}
+
+// Breaker stops calls to an upstream after FailureThreshold consecutive failures.
+// After OpenTimeout a single probe call is let through: success closes the breaker,
+// failure opens it for another OpenTimeout.
+type Breaker struct {
+	config BreakerConfig
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func NewBreaker(config BreakerConfig) *Breaker {
+	return &Breaker{config: config, state: BreakerClosed}
+}
+
+// State returns BreakerHalfOpen for an open breaker once OpenTimeout has passed.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.currentState()
+}
+
+func (b *Breaker) currentState() BreakerState {
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.config.OpenTimeout {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// allow reserves the call, half-open breaker allows one call at a time.
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState() {
+	case BreakerOpen:
+		return ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+
+	if err == nil {
+		b.state, b.failures = BreakerClosed, 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerOpen || b.failures >= b.config.FailureThreshold {
+		b.state, b.openedAt = BreakerOpen, time.Now()
+	}
+}
+
+// release frees the probe reservation of a call that was abandoned.
+func (b *Breaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+// breakerTransport guards calls to each upstream by its breaker, see Upstream.
+type breakerTransport struct {
+	next     http.RoundTripper
+	breakers map[string]*Breaker
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	breaker, ok := t.breakers[Upstream(req)]
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	err := breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil && req.Context().Err() == context.Canceled:
+		// caller gave up, says nothing about the upstream. Timeouts do count as failures.
+		breaker.release()
+	case err == nil && resp.StatusCode >= http.StatusInternalServerError:
+		breaker.record(errors.New("response failure, status = " + strconv.Itoa(resp.StatusCode)))
+	default:
+		breaker.record(err)
+	}
+
+	return resp, err
+}
+
+// WithBreakers puts calls of the client to upstreams listed in breakers behind their breakers.
+func WithBreakers(client *http.Client, breakers map[string]*Breaker) {
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.Transport = &breakerTransport{next: next, breakers: breakers}
+}
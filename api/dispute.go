@@ -0,0 +1,182 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+var (
+	OpenDisputeURL     = "/api/v1/trades/%s/open-dispute"
+	DisputeMessagesURL = "/api/v1/trades/%s/dispute/messages"
+	MediationResultURL = "/api/v1/trades/%s/mediation-result"
+
+	ErrNotFound = errors.New("not found")
+)
+
+type DisputeAttachment struct {
+	FileName string `json:"fileName"`
+	Bytes    []byte `json:"bytes"`
+}
+
+type DisputeMessage struct {
+	Message     string              `json:"message"`
+	Attachments []DisputeAttachment `json:"attachments"`
+}
+
+type MediationResult struct {
+	TradeID               string `json:"tradeId"`
+	DisputeState          string `json:"disputeState"`
+	Winner                string `json:"winner"`
+	Reason                string `json:"reason"`
+	SummaryNotes          string `json:"summaryNotes"`
+	BuyerPayoutAmount     int64  `json:"buyerPayoutAmount"`
+	SellerPayoutAmount    int64  `json:"sellerPayoutAmount"`
+	BuyerAccepted         bool   `json:"buyerAccepted"`
+	SellerAccepted        bool   `json:"sellerAccepted"`
+	MediatorNodeAddress   string `json:"mediatorNodeAddress"`
+	ArbitratorNodeAddress string `json:"arbitratorNodeAddress"`
+	CloseDate             int64  `json:"closeDate"`
+}
+
+func OpenDispute(ctx context.Context, logger *zap.Logger, client *http.Client, trade *TradeDetails) error {
+	logger = requestLogger(ctx, logger)
+	logger.Info("api.dispute.OpenDispute: received new request.")
+	apiURL := BisqAPIURL + fmt.Sprintf(OpenDisputeURL, trade.ID)
+
+	req, err := newRequest(ctx, "OpenDispute", "POST", apiURL, nil)
+	if err != nil {
+		logger.Error("api.dispute.OpenDispute: creating request failure.", zap.Error(err))
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	logger.Info("api.dispute.OpenDispute: sending request to bisq API.")
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Error("api.dispute.OpenDispute: sending request failure.", zap.Error(err))
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Error(
+			"api.dispute.OpenDispute: response failure",
+			zap.Int("status", resp.StatusCode),
+			zap.String("body", string(body)),
+		)
+		return errors.New("response failure, status = " + strconv.Itoa(resp.StatusCode))
+	}
+
+	logger.Info("api.dispute.OpenDispute: received request successfully.")
+
+	return nil
+}
+
+func PostDisputeMessage(ctx context.Context, logger *zap.Logger, client *http.Client, trade *TradeDetails, message *DisputeMessage) error {
+	logger = requestLogger(ctx, logger)
+	logger.Info("api.dispute.PostDisputeMessage: received new request.")
+	apiURL := BisqAPIURL + fmt.Sprintf(DisputeMessagesURL, trade.ID)
+
+	reqBody, err := json.Marshal(*message)
+	if err != nil {
+		logger.Error("api.dispute.PostDisputeMessage: json marshal failure.", zap.Error(err))
+		return err
+	}
+
+	req, err := newRequest(ctx, "PostDisputeMessage", "POST", apiURL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		logger.Error("api.dispute.PostDisputeMessage: creating request failure.", zap.Error(err))
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	logger.Info("api.dispute.PostDisputeMessage: sending request to bisq API.")
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Error("api.dispute.PostDisputeMessage: sending request failure.", zap.Error(err))
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Error(
+			"api.dispute.PostDisputeMessage: response failure",
+			zap.Int("status", resp.StatusCode),
+			zap.String("body", string(body)),
+		)
+		return errors.New("response failure, status = " + strconv.Itoa(resp.StatusCode))
+	}
+
+	logger.Info("api.dispute.PostDisputeMessage: received request successfully.")
+
+	return nil
+}
+
+// GetMediationResult returns ErrNotFound while the mediator has not closed the case.
+func GetMediationResult(ctx context.Context, logger *zap.Logger, client *http.Client, trade *TradeDetails) (*MediationResult, error) {
+	logger = requestLogger(ctx, logger)
+	logger.Info("api.dispute.GetMediationResult: received new request.")
+	apiURL := BisqAPIURL + fmt.Sprintf(MediationResultURL, trade.ID)
+
+	req, err := newRequest(ctx, "GetMediationResult", "GET", apiURL, nil)
+	if err != nil {
+		logger.Error("api.dispute.GetMediationResult: creating request failure.", zap.Error(err))
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	logger.Info("api.dispute.GetMediationResult: sending request to bisq API.")
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Error("api.dispute.GetMediationResult: sending request failure.", zap.Error(err))
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var m MediationResult
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		logger.Info("api.dispute.GetMediationResult: mediation result is not available.")
+		return nil, ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Error(
+			"api.dispute.GetMediationResult: response failure",
+			zap.Int("status", resp.StatusCode),
+			zap.String("body", string(body)),
+		)
+		return nil, errors.New("response failure, status = " + strconv.Itoa(resp.StatusCode))
+	}
+
+	logger.Info("api.dispute.GetMediationResult: received request successfully.")
+
+	err = json.Unmarshal(body, &m)
+	if err != nil {
+		logger.Error("api.dispute.GetMediationResult: json unmarshal failure.", zap.Error(err))
+		return nil, err
+	}
+
+	return &m, nil
+}
@@ -1,13 +1,16 @@
 package api
 
 import (
+	"bisq-add-on/money"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"go.uber.org/zap"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 )
@@ -19,6 +22,7 @@ var (
 	BisqAPIURL = "http://localhost:8080"
 
 	PaymentAccountsURL = "/api/v1/payment-accounts"
+	PaymentAccountURL  = "/api/v1/payment-accounts/%s"
 	OfferURL           = "/api/v1/offers"
 	TakeOfferURL       = "/api/v1/offers/%s/take"
 	PaymentStartedURL  = "/api/v1/trades/%s/payment-started"
@@ -26,13 +30,12 @@ var (
 
 	EthplorerAPI    = "https://api.ethplorer.io"
 	EthplorerAPIKey = "freekey"
-	GetTxURL      = "/getTxInfo/%s"
+	GetTxURL        = "/getTxInfo/%s"
 )
 
-func InitClient() *http.Client {
-	client := http.Client{
-
-	}
+// InitClient returns client whose calls give up after timeout, zero timeout never gives up.
+func InitClient(timeout time.Duration) *http.Client {
+	client := http.Client{Timeout: timeout}
 	return &client
 }
 
@@ -45,7 +48,8 @@ type PaymentAccount struct {
 	SelectedTradeCurrency string   `json:"selectedTradeCurrency"`
 }
 
-func RegisterPaymentAccounts(logger *zap.Logger, client *http.Client, account *PaymentAccount) (*PaymentAccount, error) {
+func RegisterPaymentAccounts(ctx context.Context, logger *zap.Logger, client *http.Client, account *PaymentAccount) (*PaymentAccount, error) {
+	logger = requestLogger(ctx, logger)
 	logger.Info("api.handles.RegisterPaymentAccounts: received new request.")
 	apiURL := BisqAPIURL + PaymentAccountsURL
 
@@ -55,7 +59,7 @@ func RegisterPaymentAccounts(logger *zap.Logger, client *http.Client, account *P
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(reqBody))
+	req, err := newRequest(ctx, "RegisterPaymentAccounts", "POST", apiURL, bytes.NewBuffer(reqBody))
 	if err != nil {
 		logger.Error("api.handles.RegisterPaymentAccounts: creating request failure.", zap.Error(err))
 		return nil, err
@@ -96,18 +100,57 @@ func RegisterPaymentAccounts(logger *zap.Logger, client *http.Client, account *P
 	return &p, nil
 }
 
+func RemovePaymentAccount(ctx context.Context, logger *zap.Logger, client *http.Client, accountID string) error {
+	logger = requestLogger(ctx, logger)
+	logger.Info("api.handles.RemovePaymentAccount: received new request.")
+	apiURL := BisqAPIURL + fmt.Sprintf(PaymentAccountURL, accountID)
+
+	req, err := newRequest(ctx, "RemovePaymentAccount", "DELETE", apiURL, nil)
+	if err != nil {
+		logger.Error("api.handles.RemovePaymentAccount: creating request failure.", zap.Error(err))
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	logger.Info("api.handles.RemovePaymentAccount: sending request to bisq API.")
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Error("api.handles.RemovePaymentAccount: sending request failure.", zap.Error(err))
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		logger.Error(
+			"api.handles.RemovePaymentAccount: response failure",
+			zap.Int("status", resp.StatusCode),
+			zap.String("body", string(body)),
+		)
+		return errors.New("response failure, status = " + strconv.Itoa(resp.StatusCode))
+	}
+
+	logger.Info("api.handles.RemovePaymentAccount: received request successfully.")
+
+	return nil
+}
+
 type OfferToCreate struct {
-	FundUsingBisqWallet       bool   `json:"fundUsingBisqWallet"`
-	OfferID                   string `json:"offerId"`
-	AccountID                 string `json:"accountId"`
-	Direction                 string `json:"direction"`
-	PriceType                 string `json:"priceType"`
-	MarketPair                string `json:"marketPair"`
-	PercentageFromMarketPrice int64  `json:"percentageFromMarketPrice"`
-	FixedPrice                int64  `json:"fixedPrice"`
-	Amount                    int64  `json:"amount"`
-	MinAmount                 int64  `json:"minAmount"`
-	BuyerSecurityDeposit      int64  `json:"buyerSecurityDeposit"`
+	FundUsingBisqWallet       bool    `json:"fundUsingBisqWallet"`
+	OfferID                   string  `json:"offerId"`
+	AccountID                 string  `json:"accountId"`
+	Direction                 string  `json:"direction"`
+	PriceType                 string  `json:"priceType"`
+	MarketPair                string  `json:"marketPair"`
+	PercentageFromMarketPrice float64 `json:"percentageFromMarketPrice"`
+	FixedPrice                int64   `json:"fixedPrice"`
+	Amount                    int64   `json:"amount"`
+	MinAmount                 int64   `json:"minAmount"`
+	BuyerSecurityDeposit      int64   `json:"buyerSecurityDeposit"`
 }
 
 type OfferDetail struct {
@@ -150,7 +193,8 @@ type OfferDetail struct {
 	LowerClosePrice            int64     `json:"lowerClosePrice"`
 }
 
-func PublishOffer(logger *zap.Logger, client *http.Client, offer *OfferToCreate) (*OfferDetail, error) {
+func PublishOffer(ctx context.Context, logger *zap.Logger, client *http.Client, offer *OfferToCreate) (*OfferDetail, error) {
+	logger = requestLogger(ctx, logger)
 	logger.Info("api.handles.PublishOffer: received new request.")
 	apiURL := BisqAPIURL + OfferURL
 
@@ -160,7 +204,7 @@ func PublishOffer(logger *zap.Logger, client *http.Client, offer *OfferToCreate)
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(reqBody))
+	req, err := newRequest(ctx, "PublishOffer", "POST", apiURL, bytes.NewBuffer(reqBody))
 	if err != nil {
 		logger.Error("api.handles.PublishOffer: creating request failure.", zap.Error(err))
 		return nil, err
@@ -202,6 +246,7 @@ func PublishOffer(logger *zap.Logger, client *http.Client, offer *OfferToCreate)
 }
 
 type OfferToTake struct {
+	OfferID          string `json:"-"`
 	PaymentAccountID string `json:"paymentAccountId"`
 	Amount           int64  `json:"amount"`
 }
@@ -235,9 +280,50 @@ type TradeDetails struct {
 	CounterCurrencyTxID      string         `json:"counterCurrencyTxId"`
 }
 
-func TakeOffer(logger *zap.Logger, client *http.Client, offer *OfferToTake) (*TradeDetails, error) {
+// RemoveOffer cancels an offer that was not taken yet, Bisq unlocks its funds.
+func RemoveOffer(ctx context.Context, logger *zap.Logger, client *http.Client, offerID string) error {
+	logger = requestLogger(ctx, logger)
+	logger.Info("api.handles.RemoveOffer: received new request.")
+	apiURL := BisqAPIURL + fmt.Sprintf(GetOfferURL, offerID)
+
+	req, err := newRequest(ctx, "RemoveOffer", "DELETE", apiURL, nil)
+	if err != nil {
+		logger.Error("api.handles.RemoveOffer: creating request failure.", zap.Error(err))
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	logger.Info("api.handles.RemoveOffer: sending request to bisq API.")
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Error("api.handles.RemoveOffer: sending request failure.", zap.Error(err))
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		logger.Error(
+			"api.handles.RemoveOffer: response failure",
+			zap.Int("status", resp.StatusCode),
+			zap.String("body", string(body)),
+		)
+		return errors.New("response failure, status = " + strconv.Itoa(resp.StatusCode))
+	}
+
+	logger.Info("api.handles.RemoveOffer: received request successfully.")
+
+	return nil
+}
+
+func TakeOffer(ctx context.Context, logger *zap.Logger, client *http.Client, offer *OfferToTake) (*TradeDetails, error) {
+	logger = requestLogger(ctx, logger)
 	logger.Info("api.handles.TakeOffer: received new request.")
-	apiURL := BisqAPIURL + fmt.Sprintf(TakeOfferURL, offer.PaymentAccountID)
+	apiURL := BisqAPIURL + fmt.Sprintf(TakeOfferURL, offer.OfferID)
 
 	reqBody, err := json.Marshal(*offer)
 	if err != nil {
@@ -245,7 +331,7 @@ func TakeOffer(logger *zap.Logger, client *http.Client, offer *OfferToTake) (*Tr
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(reqBody))
+	req, err := newRequest(ctx, "TakeOffer", "POST", apiURL, bytes.NewBuffer(reqBody))
 	if err != nil {
 		logger.Error("api.handles.TakeOffer: creating request failure.", zap.Error(err))
 		return nil, err
@@ -286,11 +372,12 @@ func TakeOffer(logger *zap.Logger, client *http.Client, offer *OfferToTake) (*Tr
 	return &d, nil
 }
 
-func PaymentStarted(logger *zap.Logger, client *http.Client, trade *TradeDetails) error {
+func PaymentStarted(ctx context.Context, logger *zap.Logger, client *http.Client, trade *TradeDetails) error {
+	logger = requestLogger(ctx, logger)
 	logger.Info("api.handles.PaymentStarted: received new request.")
 	apiURL := BisqAPIURL + fmt.Sprintf(PaymentStartedURL, trade.ID)
 
-	req, err := http.NewRequest("POST", apiURL, nil)
+	req, err := newRequest(ctx, "PaymentStarted", "POST", apiURL, nil)
 	if err != nil {
 		logger.Error("api.handles.PaymentStarted: creating request failure.", zap.Error(err))
 		return err
@@ -324,11 +411,12 @@ func PaymentStarted(logger *zap.Logger, client *http.Client, trade *TradeDetails
 	return nil
 }
 
-func PaymentReceived(logger *zap.Logger, client *http.Client, trade *TradeDetails) error {
+func PaymentReceived(ctx context.Context, logger *zap.Logger, client *http.Client, trade *TradeDetails) error {
+	logger = requestLogger(ctx, logger)
 	logger.Info("api.handles.PaymentReceived: received new request.")
 	apiURL := BisqAPIURL + fmt.Sprintf(PaymentReceivedURL, trade.ID)
 
-	req, err := http.NewRequest("POST", apiURL, nil)
+	req, err := newRequest(ctx, "PaymentReceived", "POST", apiURL, nil)
 	if err != nil {
 		logger.Error("api.handles.PaymentReceived: creating request failure.", zap.Error(err))
 		return err
@@ -363,20 +451,26 @@ func PaymentReceived(logger *zap.Logger, client *http.Client, trade *TradeDetail
 }
 
 type TransactionLogs struct {
+	Address string   `json:"address"`
+	Topics  []string `json:"topics"`
+	Data    string   `json:"data"`
+}
+
+type TokenInfo struct {
 	Address string `json:"address"`
-	Topics  string `json:"topics"`
-	Data    string `json:"data"`
+	Name    string `json:"name"`
+	Symbol  string `json:"symbol"`
 }
 
 type TransactionOperations struct {
-	Timestamp       int64   `json:"timestamp"`
-	TransactionHash string  `json:"transactionHash"`
-	TokenInfo       string  `json:"tokenInfo"`
-	Type            string  `json:"type"`
-	Address         string  `json:"address"`
-	From            string  `json:"from"`
-	To              string  `json:"to"`
-	Value           float64 `json:"value"`
+	Timestamp       int64        `json:"timestamp"`
+	TransactionHash string       `json:"transactionHash"`
+	TokenInfo       TokenInfo    `json:"tokenInfo"`
+	Type            string       `json:"type"`
+	Address         string       `json:"address"`
+	From            string       `json:"from"`
+	To              string       `json:"to"`
+	Value           money.Amount `json:"value"`
 }
 
 type TransactionInfo struct {
@@ -387,7 +481,7 @@ type TransactionInfo struct {
 	Success       bool                    `json:"success"`
 	From          string                  `json:"from"`
 	To            string                  `json:"to"`
-	Value         float64                 `json:"value"`
+	Value         money.Amount            `json:"value"`
 	Input         string                  `json:"input"`
 	GasLimit      int64                   `json:"gasLimit"`
 	GasUsed       int64                   `json:"gasUsed"`
@@ -395,11 +489,12 @@ type TransactionInfo struct {
 	Operations    []TransactionOperations `json:"operations"`
 }
 
-func GetTxInfo(logger *zap.Logger, client *http.Client, transactionID string) (*TransactionInfo, error) {
+func GetTxInfo(ctx context.Context, logger *zap.Logger, client *http.Client, transactionID string) (*TransactionInfo, error) {
+	logger = requestLogger(ctx, logger)
 	logger.Info("api.handles.GetTxInfo: received new request.")
-	apiURL := EthplorerAPI + fmt.Sprintf(GetTxURL, transactionID)
+	apiURL := EthplorerAPI + fmt.Sprintf(GetTxURL, url.PathEscape(transactionID))
 
-	req, err := http.NewRequest("GET", apiURL, nil)
+	req, err := newRequest(ctx, "GetTxInfo", "GET", apiURL, nil)
 	if err != nil {
 		logger.Error("api.handles.GetTxInfo: creating request failure.", zap.Error(err))
 		return nil, err
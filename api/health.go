@@ -0,0 +1,41 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+var (
+	VersionURL      = "/api/v1/version"
+	GetLastBlockURL = "/getLastBlock?apiKey=%s"
+)
+
+type Version struct {
+	Application string `json:"application"`
+}
+
+type LastBlock struct {
+	LastBlock int64 `json:"lastBlock"`
+}
+
+// GetVersion is the cheapest Bisq call, used to tell whether the node is reachable.
+func GetVersion(ctx context.Context, logger *zap.Logger, client *http.Client) (*Version, error) {
+	var version Version
+	err := getJSON(ctx, logger, client, "GetVersion", BisqAPIURL+VersionURL, &version)
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// GetLastBlock returns the latest block Ethplorer has indexed, it is the cheapest Ethplorer call.
+func GetLastBlock(ctx context.Context, logger *zap.Logger, client *http.Client) (int64, error) {
+	var block LastBlock
+	err := getJSON(ctx, logger, client, "GetLastBlock", EthplorerAPI+fmt.Sprintf(GetLastBlockURL, EthplorerAPIKey), &block)
+	if err != nil {
+		return 0, err
+	}
+	return block.LastBlock, nil
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"bisq-add-on/money"
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	MarketPricesURL = "/api/v1/currencies/prices?currencyCodes=%s"
+)
+
+type MarketPrices struct {
+	Prices map[string]money.Amount `json:"prices"`
+}
+
+// FeedPrice is a single entry of a JSON price feed.
+// Timestamp is in unix seconds.
+type FeedPrice struct {
+	Price     money.Amount `json:"price"`
+	Timestamp int64        `json:"timestamp"`
+}
+
+// GetMarketPrices returns Bisq market prices of the currencies.
+func GetMarketPrices(ctx context.Context, logger *zap.Logger, client *http.Client, currencyCodes ...string) (map[string]money.Amount, error) {
+	var p MarketPrices
+	apiURL := BisqAPIURL + fmt.Sprintf(MarketPricesURL, url.QueryEscape(strings.Join(currencyCodes, ",")))
+	err := getJSON(ctx, logger, client, "GetMarketPrices", apiURL, &p)
+	if err != nil {
+		return nil, err
+	}
+	return p.Prices, nil
+}
+
+// GetPriceFeed reads JSON price feed of the form {"<token>": {"price": 1, "timestamp": 1}}.
+func GetPriceFeed(ctx context.Context, logger *zap.Logger, client *http.Client, feedURL string) (map[string]FeedPrice, error) {
+	var p map[string]FeedPrice
+	err := getJSON(ctx, logger, client, "GetPriceFeed", feedURL, &p)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
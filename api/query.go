@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+var (
+	GetOfferURL = "/api/v1/offers/%s"
+	TradesURL   = "/api/v1/trades"
+	GetTradeURL = "/api/v1/trades/%s"
+)
+
+type OfferList struct {
+	Offers []OfferDetail `json:"offers"`
+	Total  int           `json:"total"`
+}
+
+type TradeList struct {
+	Trades []TradeDetails `json:"trades"`
+	Total  int            `json:"total"`
+}
+
+type PaymentAccountList struct {
+	PaymentAccounts []PaymentAccount `json:"paymentAccounts"`
+}
+
+// getJSON sends GET request to bisq API and decodes response into v.
+// Returns ErrNotFound on 404, so callers can tell missing entities from failures.
+func getJSON(ctx context.Context, logger *zap.Logger, client *http.Client, name string, apiURL string, v interface{}) error {
+	logger = requestLogger(ctx, logger)
+	logger.Info("api.query." + name + ": received new request.")
+
+	req, err := newRequest(ctx, name, "GET", apiURL, nil)
+	if err != nil {
+		logger.Error("api.query."+name+": creating request failure.", zap.Error(err))
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	logger.Info("api.query." + name + ": sending request to bisq API.")
+	resp, err := client.Do(req)
+	if err != nil {
+		logger.Error("api.query."+name+": sending request failure.", zap.Error(err))
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		logger.Info("api.query." + name + ": entity not found.")
+		return ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		logger.Error(
+			"api.query."+name+": response failure",
+			zap.Int("status", resp.StatusCode),
+			zap.String("body", string(body)),
+		)
+		return errors.New("response failure, status = " + strconv.Itoa(resp.StatusCode))
+	}
+
+	logger.Info("api.query." + name + ": received request successfully.")
+
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		logger.Error("api.query."+name+": json unmarshal failure.", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func ListOffers(ctx context.Context, logger *zap.Logger, client *http.Client) ([]OfferDetail, error) {
+	var l OfferList
+	err := getJSON(ctx, logger, client, "ListOffers", BisqAPIURL+OfferURL, &l)
+	if err != nil {
+		return nil, err
+	}
+	return l.Offers, nil
+}
+
+func GetOffer(ctx context.Context, logger *zap.Logger, client *http.Client, offerID string) (*OfferDetail, error) {
+	var d OfferDetail
+	err := getJSON(ctx, logger, client, "GetOffer", BisqAPIURL+fmt.Sprintf(GetOfferURL, offerID), &d)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func ListTrades(ctx context.Context, logger *zap.Logger, client *http.Client) ([]TradeDetails, error) {
+	var l TradeList
+	err := getJSON(ctx, logger, client, "ListTrades", BisqAPIURL+TradesURL, &l)
+	if err != nil {
+		return nil, err
+	}
+	return l.Trades, nil
+}
+
+func GetTrade(ctx context.Context, logger *zap.Logger, client *http.Client, tradeID string) (*TradeDetails, error) {
+	var d TradeDetails
+	err := getJSON(ctx, logger, client, "GetTrade", BisqAPIURL+fmt.Sprintf(GetTradeURL, tradeID), &d)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func GetPaymentAccounts(ctx context.Context, logger *zap.Logger, client *http.Client) ([]PaymentAccount, error) {
+	var l PaymentAccountList
+	err := getJSON(ctx, logger, client, "GetPaymentAccounts", BisqAPIURL+PaymentAccountsURL, &l)
+	if err != nil {
+		return nil, err
+	}
+	return l.PaymentAccounts, nil
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+)
+
+// TLSOptions configure TLS of calls to a Bisq node behind a reverse proxy.
+type TLSOptions struct {
+	// CAFile is PEM bundle trusted in addition to system roots, e.g. a private proxy CA.
+	CAFile string
+	// CertFile and KeyFile are the client certificate, for proxies that require one.
+	CertFile string
+	KeyFile  string
+}
+
+// bisqTransport sends Bisq calls through the TLS configured transport,
+// other upstreams keep the transport the client had.
+type bisqTransport struct {
+	bisq *http.Transport
+	next http.RoundTripper
+}
+
+func (t *bisqTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if Upstream(req) == UpstreamBisq {
+		return t.bisq.RoundTrip(req)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// WithTLS applies the options to Bisq calls of the client, Ethplorer and price feeds keep default TLS.
+// It has to be called before the transport is wrapped.
+func WithTLS(client *http.Client, options TLSOptions) error {
+	config := tls.Config{MinVersion: tls.VersionTLS12}
+
+	if options.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		pem, err := ioutil.ReadFile(options.CAFile)
+		if err != nil {
+			return err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in " + options.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if options.CertFile != "" || options.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &config
+	client.Transport = &bisqTransport{bisq: transport, next: next}
+
+	return nil
+}
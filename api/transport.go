@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type endpointKey struct{}
+
+type requestIDKey struct{}
+
+// RequestIDHeader carries the ID of the inbound request to upstream services.
+const RequestIDHeader = "X-Request-ID"
+
+// WithRequestID returns context that tags api calls made with it by the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID of the context, empty if there is none.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// requestLogger adds the request ID of the context to the logger.
+func requestLogger(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	requestID := RequestID(ctx)
+	if requestID == "" {
+		return logger
+	}
+	return logger.With(zap.String("requestId", requestID))
+}
+
+// newRequest creates request tagged with the name of the API call,
+// so transports wrapping the client can tell calls apart without parsing URLs.
+// Request ID of the context is forwarded in RequestIDHeader.
+func newRequest(ctx context.Context, endpoint string, method string, apiURL string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, apiURL, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if requestID := RequestID(ctx); requestID != "" {
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+
+	return req.WithContext(context.WithValue(ctx, endpointKey{}, endpoint)), nil
+}
+
+// Endpoint returns the name of the API call the request was created for, e.g. "PublishOffer".
+func Endpoint(req *http.Request) string {
+	endpoint, ok := req.Context().Value(endpointKey{}).(string)
+	if !ok {
+		return "unknown"
+	}
+	return endpoint
+}
+
+// Upstreams the api package calls.
+const (
+	UpstreamBisq      = "bisq"
+	UpstreamEthplorer = "ethplorer"
+	UpstreamFeed      = "feed"
+)
+
+// Upstream tells which service the request goes to, UpstreamFeed for price feeds.
+func Upstream(req *http.Request) string {
+	u := req.URL.String()
+	switch {
+	case strings.HasPrefix(u, BisqAPIURL):
+		return UpstreamBisq
+	case strings.HasPrefix(u, EthplorerAPI):
+		return UpstreamEthplorer
+	}
+	return UpstreamFeed
+}
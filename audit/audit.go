@@ -0,0 +1,177 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// SystemPrincipal is the principal of operations the service does on its own, e.g. expiring trades.
+const SystemPrincipal = "system"
+
+var ErrBrokenChain = errors.New("audit log chain is broken")
+
+// Entry is a single audited operation.
+// Hash covers every other field, PrevHash links it to the entry before,
+// so changing or dropping an entry breaks every hash after it.
+type Entry struct {
+	Seq           int64     `json:"seq"`
+	Time          time.Time `json:"time"`
+	Principal     string    `json:"principal"`
+	Operation     string    `json:"operation"`
+	TradeID       string    `json:"tradeId,omitempty"`
+	PayloadDigest string    `json:"payloadDigest,omitempty"`
+	State         string    `json:"state"`
+	Calls         []string  `json:"calls,omitempty"`
+	PrevHash      string    `json:"prevHash"`
+	Hash          string    `json:"hash"`
+}
+
+func (e *Entry) computeHash() (string, error) {
+	copied := *e
+	copied.Hash = ""
+	data, err := json.Marshal(&copied)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Digest is the hex SHA-256 of the JSON encoding of payload.
+func Digest(payload interface{}) string {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Log appends entries to a JSON lines file.
+type Log struct {
+	mu       sync.Mutex
+	file     *os.File
+	seq      int64
+	lastHash string
+}
+
+// Open opens the log at path, creating it if needed.
+// Existing entries are verified and the chain continues from the last one.
+func Open(path string) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	l := Log{file: file}
+	err = Verify(file, func(entry *Entry) error {
+		l.seq, l.lastHash = entry.Seq, entry.Hash
+		return nil
+	})
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &l, nil
+}
+
+// Append adds the entry to the chain, filling in Seq, Time and hashes.
+func (l *Log) Append(entry Entry) (*Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.Seq = l.seq + 1
+	entry.Time = time.Now().UTC()
+	entry.PrevHash = l.lastHash
+
+	hash, err := entry.computeHash()
+	if err != nil {
+		return nil, err
+	}
+	entry.Hash = hash
+
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = l.file.Write(append(data, '\n'))
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.file.Sync()
+	if err != nil {
+		return nil, err
+	}
+
+	l.seq, l.lastHash = entry.Seq, entry.Hash
+
+	return &entry, nil
+}
+
+// Check reports whether the log file is still writable.
+func (l *Log) Check() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+func (l *Log) Close() error {
+	return l.file.Close()
+}
+
+// Verify reads the whole log and checks every link of the chain.
+// Each verified entry is passed to fn, which can stop reading by returning an error.
+func Verify(r io.Reader, fn func(entry *Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var prev Entry
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry Entry
+		err := json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+
+		if entry.Seq != prev.Seq+1 || entry.PrevHash != prev.Hash {
+			return fmt.Errorf("line %d: %w: entry %d does not follow entry %d", line, ErrBrokenChain, entry.Seq, prev.Seq)
+		}
+
+		hash, err := entry.computeHash()
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		if hash != entry.Hash {
+			return fmt.Errorf("line %d: %w: entry %d was modified", line, ErrBrokenChain, entry.Seq)
+		}
+
+		err = fn(&entry)
+		if err != nil {
+			return err
+		}
+
+		prev = entry
+	}
+
+	return scanner.Err()
+}
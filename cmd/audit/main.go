@@ -0,0 +1,62 @@
+// Command audit verifies the audit log of the service and exports its entries.
+//
+//	audit -log audit.log verify
+//	audit -log audit.log -trade <trade id> export
+package main
+
+import (
+	"bisq-add-on/audit"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+func main() {
+	logPath := flag.String("log", "audit.log", "path to the audit log")
+	tradeID := flag.String("trade", "", "export only entries of the trade")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] verify|export\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	file, err := os.Open(*logPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	switch flag.Arg(0) {
+	case "verify":
+		count := 0
+		err = audit.Verify(file, func(entry *audit.Entry) error {
+			count++
+			return nil
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("audit log is intact, %d entries verified.\n", count)
+	case "export":
+		enc := json.NewEncoder(os.Stdout)
+		err = audit.Verify(file, func(entry *audit.Entry) error {
+			if *tradeID != "" && entry.TradeID != *tradeID {
+				return nil
+			}
+			return enc.Encode(entry)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -2,4 +2,9 @@ module bisq-add-on
 
 go 1.13
 
-require go.uber.org/zap v1.15.0 // indirect
+require (
+	github.com/decred/dcrd/dcrec/secp256k1/v3 v3.0.0
+	github.com/prometheus/client_golang v1.7.1
+	go.uber.org/zap v1.15.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+)
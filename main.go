@@ -2,16 +2,90 @@ package main
 
 import (
 	"bisq-add-on/server"
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	service := server.InitService()
+	configPath := flag.String("config", "", "path to JSON config file")
+	flag.Parse()
 
-	http.HandleFunc("/buy", service.BuyHandle)
-	http.HandleFunc("/sell", service.SellHandle)
-	http.HandleFunc("/check-offer", service.CheckOfferHandle)
+	config, err := server.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	service, err := server.InitService(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	routes := map[string]http.HandlerFunc{
+		"/register":               service.RegisterHandle,
+		"/wallet/challenge":       service.WalletChallengeHandle,
+		"/wallet/verify":          service.WalletVerifyHandle,
+		"/buy":                    service.BuyHandle,
+		"/sell":                   service.SellHandle,
+		"/offer/preview":          service.OfferPreviewHandle,
+		"/check-offer":            service.CheckOfferHandle,
+		"/money-sent":             service.MoneySentHandle,
+		"/notifications":          service.NotificationsHandle,
+		"/accounts/stats":         service.AccountStatsHandle,
+		"/dispute":                service.DisputeHandle,
+		"/admin/revenue":          service.RevenueHandle,
+		"/admin/offers":           service.AdminOffersHandle,
+		"/admin/offers/cancel":    service.AdminCancelOfferHandle,
+		"/admin/trades":           service.AdminTradesHandle,
+		"/admin/trades/detail":    service.AdminTradeHandle,
+		"/admin/trades/state":     service.AdminTradeStateHandle,
+		"/admin/trades/retry":     service.AdminRetryHandle,
+		"/admin/accounts/suspend": service.AdminSuspendHandle,
+		"/admin/markets/halt":     service.AdminHaltHandle,
+		"/status":                 service.StatusHandle,
+	}
+	for route, handler := range routes {
+		http.HandleFunc(route, service.Instrument(route, service.Protect(handler)))
+	}
+
+	// probes are not rate limited, orchestrators poll them.
+	probes := map[string]http.HandlerFunc{
+		"/healthz": service.HealthzHandle,
+		"/readyz":  service.ReadyzHandle,
+	}
+	for route, handler := range probes {
+		http.HandleFunc(route, service.Instrument(route, handler))
+	}
+
+	http.Handle("/metrics", service.MetricsHandler())
+
+	tlsConfig, err := service.TLSConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	httpServer := &http.Server{Addr: config.ListenAddr, TLSConfig: tlsConfig}
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			// certificate comes from tlsConfig, it is reloaded when the files change.
+			err = httpServer.ListenAndServeTLS("", "")
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	err = service.ShutdownOnSignal(stop, httpServer)
+	if err != nil {
+		log.Println("service shutdown:", err)
+	}
 }
@@ -0,0 +1,309 @@
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidAmount = errors.New("invalid amount")
+	ErrPrecisionLoss = errors.New("amount has more decimals than allowed")
+	ErrOverflow      = errors.New("amount does not fit into int64")
+	ErrOutOfRange    = errors.New("amount is out of range")
+)
+
+// Limits of parsed amounts. Amounts come from clients, price feeds and config,
+// without the limits a short string like "1e30000000" makes arithmetic arbitrarily expensive.
+const (
+	maxExponent = 100
+	maxDigits   = 100
+	maxScale    = 100
+)
+
+var ten = big.NewInt(10)
+
+// Amount is an exact decimal number, value * 10^-scale.
+// Zero value is a valid zero amount.
+type Amount struct {
+	value *big.Int
+	scale int
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(ten, big.NewInt(int64(n)), nil)
+}
+
+func (a Amount) bigValue() *big.Int {
+	if a.value == nil {
+		return new(big.Int)
+	}
+	return a.value
+}
+
+// New returns value * 10^-scale.
+func New(value int64, scale int) Amount {
+	return Amount{value: big.NewInt(value), scale: scale}
+}
+
+// FromUnits converts integer amount of base units of a token with decimals to Amount.
+func FromUnits(units *big.Int, decimals int) Amount {
+	return Amount{value: new(big.Int).Set(units), scale: decimals}
+}
+
+// Parse reads decimal string like "12", "-0.015" or "1.5e-3" exactly.
+// Fails with ErrOutOfRange when the amount has more than maxDigits digits,
+// its exponent is over maxExponent or its scale over maxScale either way.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Amount{}, ErrInvalidAmount
+	}
+
+	exponent := 0
+	if i := strings.IndexAny(s, "eE"); i != -1 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return Amount{}, ErrInvalidAmount
+		}
+		if e > maxExponent || e < -maxExponent {
+			return Amount{}, ErrOutOfRange
+		}
+		exponent = e
+		s = s[:i]
+	}
+	if s == "" {
+		return Amount{}, ErrInvalidAmount
+	}
+
+	sign := ""
+	if s[0] == '-' || s[0] == '+' {
+		sign, s = s[:1], s[1:]
+	}
+
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i != -1 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	if intPart == "" && fracPart == "" {
+		return Amount{}, ErrInvalidAmount
+	}
+
+	digits := intPart + fracPart
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return Amount{}, ErrInvalidAmount
+		}
+	}
+
+	if len(digits) > maxDigits {
+		return Amount{}, ErrOutOfRange
+	}
+	scale := len(fracPart) - exponent
+	if scale > maxScale || scale < -maxScale {
+		return Amount{}, ErrOutOfRange
+	}
+
+	value, ok := new(big.Int).SetString(sign+digits, 10)
+	if !ok {
+		return Amount{}, ErrInvalidAmount
+	}
+
+	a := Amount{value: value, scale: scale}
+	if a.scale < 0 {
+		a.value.Mul(a.value, pow10(-a.scale))
+		a.scale = 0
+	}
+
+	return a.normalize(), nil
+}
+
+// MustParse is Parse for constants, it panics on invalid input.
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// normalize drops trailing zeros of the fraction.
+func (a Amount) normalize() Amount {
+	value := new(big.Int).Set(a.bigValue())
+	scale := a.scale
+
+	if value.Sign() == 0 {
+		return Amount{value: value}
+	}
+
+	rem := new(big.Int)
+	for scale > 0 {
+		q, r := new(big.Int).QuoRem(value, ten, rem)
+		if r.Sign() != 0 {
+			break
+		}
+		value = q
+		scale--
+	}
+
+	return Amount{value: value, scale: scale}
+}
+
+// align returns values of both amounts at the same scale.
+func align(a Amount, b Amount) (*big.Int, *big.Int, int) {
+	av, bv := new(big.Int).Set(a.bigValue()), new(big.Int).Set(b.bigValue())
+	switch {
+	case a.scale > b.scale:
+		bv.Mul(bv, pow10(a.scale-b.scale))
+		return av, bv, a.scale
+	case b.scale > a.scale:
+		av.Mul(av, pow10(b.scale-a.scale))
+		return av, bv, b.scale
+	}
+	return av, bv, a.scale
+}
+
+func (a Amount) Sign() int {
+	return a.bigValue().Sign()
+}
+
+func (a Amount) IsZero() bool {
+	return a.Sign() == 0
+}
+
+func (a Amount) Cmp(b Amount) int {
+	av, bv, _ := align(a, b)
+	return av.Cmp(bv)
+}
+
+func (a Amount) Add(b Amount) Amount {
+	av, bv, scale := align(a, b)
+	return Amount{value: av.Add(av, bv), scale: scale}.normalize()
+}
+
+func (a Amount) Sub(b Amount) Amount {
+	av, bv, scale := align(a, b)
+	return Amount{value: av.Sub(av, bv), scale: scale}.normalize()
+}
+
+func (a Amount) Neg() Amount {
+	return Amount{value: new(big.Int).Neg(a.bigValue()), scale: a.scale}
+}
+
+func (a Amount) Abs() Amount {
+	return Amount{value: new(big.Int).Abs(a.bigValue()), scale: a.scale}
+}
+
+func (a Amount) Mul(b Amount) Amount {
+	value := new(big.Int).Mul(a.bigValue(), b.bigValue())
+	return Amount{value: value, scale: a.scale + b.scale}.normalize()
+}
+
+// Shift multiplies amount by 10^n exactly.
+func (a Amount) Shift(n int) Amount {
+	r := Amount{value: new(big.Int).Set(a.bigValue()), scale: a.scale - n}
+	if r.scale < 0 {
+		r.value.Mul(r.value, pow10(-r.scale))
+		r.scale = 0
+	}
+	return r.normalize()
+}
+
+// Units returns amount in base units of a token with decimals.
+// Fails with ErrPrecisionLoss when the amount has more decimals.
+func (a Amount) Units(decimals int) (*big.Int, error) {
+	a = a.normalize()
+	if a.scale > decimals {
+		return nil, ErrPrecisionLoss
+	}
+	return new(big.Int).Mul(a.value, pow10(decimals-a.scale)), nil
+}
+
+// Int64Units is Units that has to fit into int64, e.g. for Bisq requests.
+func (a Amount) Int64Units(decimals int) (int64, error) {
+	units, err := a.Units(decimals)
+	if err != nil {
+		return 0, err
+	}
+	if !units.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return units.Int64(), nil
+}
+
+// RoundUp rounds amount towards positive infinity to decimals.
+func (a Amount) RoundUp(decimals int) Amount {
+	a = a.normalize()
+	if a.scale <= decimals {
+		return a
+	}
+
+	div := pow10(a.scale - decimals)
+	q, r := new(big.Int).QuoRem(a.value, div, new(big.Int))
+	if r.Sign() > 0 {
+		q.Add(q, big.NewInt(1))
+	}
+
+	return Amount{value: q, scale: decimals}.normalize()
+}
+
+// Rat returns amount as exact rational number.
+func (a Amount) Rat() *big.Rat {
+	a = a.normalize()
+	return new(big.Rat).SetFrac(a.value, pow10(a.scale))
+}
+
+func (a Amount) String() string {
+	a = a.normalize()
+
+	digits := new(big.Int).Abs(a.value).String()
+	sign := ""
+	if a.value.Sign() < 0 {
+		sign = "-"
+	}
+
+	if a.scale == 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= a.scale {
+		digits = strings.Repeat("0", a.scale-len(digits)+1) + digits
+	}
+
+	point := len(digits) - a.scale
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// MarshalJSON writes amount as a string, so clients do not round it through floats.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON accepts both JSON strings and numbers, numbers are read exactly.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*a = Amount{}
+		return nil
+	}
+
+	s := string(data)
+	if len(data) != 0 && data[0] == '"' {
+		err := json.Unmarshal(data, &s)
+		if err != nil {
+			return err
+		}
+	}
+
+	parsed, err := Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid amount %q", s)
+	}
+
+	*a = parsed
+	return nil
+}
@@ -0,0 +1,103 @@
+package money
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"12", "12"},
+		{"-0.015", "-0.015"},
+		{"+1.50", "1.5"},
+		{".5", "0.5"},
+		{"5.", "5"},
+		{"1.5e-3", "0.0015"},
+		{"1.5E3", "1500"},
+		{"1e+2", "100"},
+		{" 7 ", "7"},
+		{"0.000", "0"},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", test.in, err)
+			continue
+		}
+		if got.String() != test.want {
+			t.Errorf("Parse(%q) = %s, want %s", test.in, got, test.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		in   string
+		want error
+	}{
+		// empty
+		{"", ErrInvalidAmount},
+		{"   ", ErrInvalidAmount},
+		{".", ErrInvalidAmount},
+		// sign only
+		{"-", ErrInvalidAmount},
+		{"+", ErrInvalidAmount},
+		{"-.", ErrInvalidAmount},
+		{"-e5", ErrInvalidAmount},
+		// exponent only
+		{"e5", ErrInvalidAmount},
+		{"E1", ErrInvalidAmount},
+		{"e", ErrInvalidAmount},
+		{"1e", ErrInvalidAmount},
+		{"1e5e5", ErrInvalidAmount},
+		// malformed
+		{"1.2.3", ErrInvalidAmount},
+		{"0x10", ErrInvalidAmount},
+		{"1,5", ErrInvalidAmount},
+		{"--1", ErrInvalidAmount},
+		// over bounds
+		{"1e101", ErrOutOfRange},
+		{"1e-101", ErrOutOfRange},
+		{"1e30000000", ErrOutOfRange},
+		{strings.Repeat("9", maxDigits+1), ErrOutOfRange},
+		{"0." + strings.Repeat("1", maxScale+1), ErrOutOfRange},
+		{"0.1e-100", ErrOutOfRange},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.in)
+		if err != test.want {
+			t.Errorf("Parse(%q) error = %v, want %v", test.in, err, test.want)
+		}
+	}
+}
+
+func TestParseBounds(t *testing.T) {
+	for _, in := range []string{"1e100", "1e-100", strings.Repeat("9", maxDigits), "." + strings.Repeat("1", maxScale)} {
+		if _, err := Parse(in); err != nil {
+			t.Errorf("Parse(%q) failed: %v", in, err)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	var offer struct {
+		Price Amount `json:"price"`
+	}
+
+	for _, body := range []string{`{"price":"e5"}`, `{"price":"-"}`, `{"price":""}`, `{"price":"1e30000000"}`} {
+		if err := json.Unmarshal([]byte(body), &offer); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded, price = %s", body, offer.Price)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"price":1.10}`), &offer); err != nil {
+		t.Fatal(err)
+	}
+	if offer.Price.String() != "1.1" {
+		t.Errorf("price = %s, want 1.1", offer.Price)
+	}
+}
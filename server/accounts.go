@@ -0,0 +1,175 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"context"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// accountKey identifies a Bisq payment account the service keeps for a user.
+type accountKey struct {
+	Owner    string
+	Currency string
+	Address  string
+}
+
+func (k accountKey) matches(account *api.PaymentAccount) bool {
+	return account.Name == k.Owner &&
+		account.SelectedTradeCurrency == k.Currency &&
+		strings.EqualFold(account.Details, k.Address)
+}
+
+// accountLookup is a payment account lookup shared by concurrent callers asking for the same key.
+// account and err are set before done is closed.
+type accountLookup struct {
+	done    chan struct{}
+	account *api.PaymentAccount
+	err     error
+}
+
+// paymentAccount returns Bisq payment account of the owner for the market currency and address.
+// Account is looked up in the cache first, then in Bisq, and registered only when missing.
+// Concurrent callers for the same key wait for one lookup, so Bisq calls run without holding a lock
+// and the account is registered once. Accounts of the owner for the same currency but another address are retired.
+func (s *Service) paymentAccount(ctx context.Context, owner string, market *Market, address string) (*api.PaymentAccount, error) {
+	key := accountKey{Owner: owner, Currency: market.CurrencyCode, Address: strings.ToLower(address)}
+
+	s.mu.Lock()
+	account, ok := s.accounts[key]
+	lookup, pending := s.accountLookups[key]
+	if !ok && !pending {
+		lookup = &accountLookup{done: make(chan struct{})}
+		s.accountLookups[key] = lookup
+	}
+	s.mu.Unlock()
+
+	if ok {
+		s.log(ctx).Info("server.accounts.paymentAccount: using cached account.", zap.String("account", account.ID))
+		return account, nil
+	}
+
+	if pending {
+		select {
+		case <-lookup.done:
+			return lookup.account, lookup.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	account, created, err := s.lookupPaymentAccount(ctx, key, market)
+
+	s.mu.Lock()
+	if err == nil {
+		s.accounts[key] = account
+		if created {
+			s.createdAccounts[account.ID] = owner
+		}
+	}
+	delete(s.accountLookups, key)
+	s.mu.Unlock()
+
+	lookup.account, lookup.err = account, err
+	close(lookup.done)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.retireAccounts(ctx, key)
+
+	return account, nil
+}
+
+// lookupPaymentAccount finds the account of the key in Bisq or registers it,
+// created is true when the account was registered by this call.
+func (s *Service) lookupPaymentAccount(ctx context.Context, key accountKey, market *Market) (*api.PaymentAccount, bool, error) {
+	accounts, err := api.GetPaymentAccounts(ctx, s.logger, s.client)
+	if err != nil {
+		s.log(ctx).Error("server.accounts.lookupPaymentAccount: api.GetPaymentAccounts failure.")
+		return nil, false, err
+	}
+
+	for i := range accounts {
+		if key.matches(&accounts[i]) {
+			s.log(ctx).Info("server.accounts.lookupPaymentAccount: found existing account in bisq.", zap.String("account", accounts[i].ID))
+			return &accounts[i], false, nil
+		}
+	}
+
+	toRegister := api.PaymentAccount{
+		Name:                  key.Owner,
+		TradeCurrencies:       market.TradeCurrencies,
+		PaymentMethod:         market.PaymentMethod,
+		ID:                    "",
+		Details:               key.Address,
+		SelectedTradeCurrency: market.CurrencyCode,
+	}
+
+	account, err := api.RegisterPaymentAccounts(ctx, s.logger, s.client, &toRegister)
+	s.auditCall("", "RegisterPaymentAccounts", &toRegister, err)
+	if err != nil {
+		s.log(ctx).Error("server.accounts.lookupPaymentAccount: api.RegisterPaymentAccounts failure.")
+		return nil, false, err
+	}
+
+	s.log(ctx).Info("server.accounts.lookupPaymentAccount: registered new account.", zap.String("account", account.ID))
+	return account, true, nil
+}
+
+// retireAccounts removes accounts of the owner for the currency that point to another address.
+// Accounts used by open trades are kept and retired on a later lookup.
+func (s *Service) retireAccounts(ctx context.Context, current accountKey) {
+	var stale []accountKey
+
+	s.mu.Lock()
+	for key, account := range s.accounts {
+		if key.Owner != current.Owner || key.Currency != current.Currency || key.Address == current.Address {
+			continue
+		}
+		if s.isAccountInUse(account.ID) {
+			continue
+		}
+		stale = append(stale, key)
+	}
+	s.mu.Unlock()
+
+	for _, key := range stale {
+		// a concurrent lookup of the owner may have retired the account already.
+		s.mu.Lock()
+		account, ok := s.accounts[key]
+		delete(s.accounts, key)
+		s.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		err := api.RemovePaymentAccount(ctx, s.logger, s.client, account.ID)
+		s.auditCall("", "RemovePaymentAccount", account.ID, err)
+		if err != nil {
+			s.log(ctx).Error("server.accounts.retireAccounts: api.RemovePaymentAccount failure.", zap.Error(err))
+			continue
+		}
+
+		s.mu.Lock()
+		delete(s.createdAccounts, account.ID)
+		s.mu.Unlock()
+
+		s.log(ctx).Info("server.accounts.retireAccounts: retired account with outdated wallet.", zap.String("account", account.ID))
+	}
+}
+
+// isAccountInUse reports whether an open Bisq trade refers to the account.
+// Caller must hold s.mu.
+func (s *Service) isAccountInUse(accountID string) bool {
+	for _, trade := range s.trades {
+		if trade.Settlement != SettlementBisq || trade.State == TradeStateCompleted || trade.State == TradeStateCancelled {
+			continue
+		}
+		if trade.Details.Offer.MakerPaymentAccountID == accountID || trade.Details.TakerPaymentAccountID == accountID {
+			return true
+		}
+	}
+	return false
+}
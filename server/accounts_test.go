@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPaymentAccountRegistersOnce(t *testing.T) {
+	existing := api.PaymentAccount{ID: "existing", Name: "bob", Details: "0xb0b", SelectedTradeCurrency: "ETH"}
+
+	var registrations int32
+	bisq := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != api.PaymentAccountsURL {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == "POST" {
+			var account api.PaymentAccount
+			_ = json.NewDecoder(r.Body).Decode(&account)
+			account.ID = "registered"
+			atomic.AddInt32(&registrations, 1)
+			_ = json.NewEncoder(w).Encode(&account)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(&api.PaymentAccountList{PaymentAccounts: []api.PaymentAccount{existing}})
+	}))
+	defer bisq.Close()
+
+	dir, err := ioutil.TempDir("", "accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestService(t, bisq.URL, dir)
+	market := &Market{Token: "ETH", CurrencyCode: "ETH"}
+
+	account, err := s.paymentAccount(context.Background(), "bob", market, "0xB0B")
+	if err != nil || account.ID != existing.ID {
+		t.Fatalf("existing account: account = %v, error = %v, want %q", account, err, existing.ID)
+	}
+
+	var wg sync.WaitGroup
+	ids := make(chan string, 8)
+	for i := 0; i < cap(ids); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			account, err := s.paymentAccount(context.Background(), "alice", market, "0xa11ce")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ids <- account.ID
+		}()
+	}
+	wg.Wait()
+	close(ids)
+
+	for id := range ids {
+		if id != "registered" {
+			t.Errorf("concurrent lookup returned account %q, want the registered one", id)
+		}
+	}
+	if n := atomic.LoadInt32(&registrations); n != 1 {
+		t.Fatalf("registered %d accounts, want one", n)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.createdAccounts[existing.ID]; ok {
+		t.Error("account found in bisq is marked as created")
+	}
+	if s.createdAccounts["registered"] != "alice" {
+		t.Error("registered account is not marked as created")
+	}
+}
@@ -0,0 +1,540 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"bisq-add-on/money"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// AuditAdminPrincipal is the principal of operations done through the admin API.
+const AuditAdminPrincipal = "admin"
+
+// Audited admin operations.
+const (
+	AuditAdminOfferCancel    = "admin.offer.cancel"
+	AuditAdminRetry          = "admin.trade.retry"
+	AuditAdminAccountSuspend = "admin.account.suspend"
+	AuditAdminMarketHalt     = "admin.market.halt"
+)
+
+// Saga steps an operator can retry.
+const (
+	// RetryStepPayment repeats Bisq payment confirmation of a settled trade stuck in PAYMENT_SENT.
+	RetryStepPayment = "payment"
+	// RetryStepDispute repeats opening of the Bisq dispute of a disputed or cancelled trade.
+	RetryStepDispute = "dispute"
+)
+
+const (
+	OfferStateOpen              = "OPEN"
+	OfferStatePendingSettlement = "PENDING_SETTLEMENT"
+)
+
+// AdminOffer is a resting offer or an offer of a match waiting for Bisq.
+type AdminOffer struct {
+	Direction string     `json:"direction"`
+	State     string     `json:"state"`
+	CreatedAt time.Time  `json:"createdAt"`
+	Offer     *UserOffer `json:"offer"`
+}
+
+// AdminTrade is the full state of the trade, including its state history.
+type AdminTrade struct {
+	ID                   string                    `json:"id"`
+	Settlement           string                    `json:"settlement"`
+	State                TradeState                `json:"state"`
+	BuyOffer             *UserOffer                `json:"buyOffer"`
+	SellOffer            *UserOffer                `json:"sellOffer"`
+	Price                money.Amount              `json:"price"`
+	CreatedAt            time.Time                 `json:"createdAt"`
+	Deadline             time.Time                 `json:"deadline"`
+	Warned               bool                      `json:"warned"`
+	DisputeOpened        bool                      `json:"disputeOpened"`
+	DisputeLoser         string                    `json:"disputeLoser,omitempty"`
+	DepositFeesCollected bool                      `json:"depositFeesCollected"`
+	Legs                 map[string]*SettlementLeg `json:"legs"`
+	Fees                 map[string]*TradeFee      `json:"fees"`
+	Details              *api.TradeDetails         `json:"details,omitempty"`
+	History              []TradeTransition         `json:"history"`
+}
+
+type CancelOfferRequest struct {
+	AccountName string `json:"accountName"`
+	Direction   string `json:"direction"`
+	Reason      string `json:"reason"`
+}
+
+type ForceTradeStateRequest struct {
+	TradeID string     `json:"tradeId"`
+	State   TradeState `json:"state"`
+	Reason  string     `json:"reason"`
+}
+
+type RetryStepRequest struct {
+	TradeID string `json:"tradeId"`
+	Step    string `json:"step"`
+	Reason  string `json:"reason"`
+}
+
+type SuspendAccountRequest struct {
+	AccountName string `json:"accountName"`
+	Suspended   bool   `json:"suspended"`
+	Reason      string `json:"reason"`
+}
+
+type HaltMarketRequest struct {
+	Token  string `json:"token"`
+	Halted bool   `json:"halted"`
+	Reason string `json:"reason"`
+}
+
+var tradeStates = map[TradeState]bool{
+	TradeStatePending:          true,
+	TradeStatePartiallySettled: true,
+	TradeStatePaymentSent:      true,
+	TradeStateCompleted:        true,
+	TradeStateDisputed:         true,
+	TradeStateCancelled:        true,
+}
+
+// adminTrade copies the trade, so it can be encoded after s.mu is released. Caller must hold s.mu.
+func adminTrade(trade *Trade) *AdminTrade {
+	view := AdminTrade{
+		ID:                   trade.ID,
+		Settlement:           trade.Settlement,
+		State:                trade.State,
+		BuyOffer:             trade.BuyOffer,
+		SellOffer:            trade.SellOffer,
+		Price:                trade.Price,
+		CreatedAt:            trade.CreatedAt,
+		Deadline:             trade.Deadline,
+		Warned:               trade.Warned,
+		DisputeOpened:        trade.DisputeOpened,
+		DisputeLoser:         trade.DisputeLoser,
+		DepositFeesCollected: trade.DepositFeesCollected,
+		Legs:                 make(map[string]*SettlementLeg, len(trade.Legs)),
+		Fees:                 make(map[string]*TradeFee, len(trade.Fees)),
+		History:              make([]TradeTransition, len(trade.History)),
+	}
+	if trade.Details != nil {
+		details := *trade.Details
+		view.Details = &details
+	}
+	for role, leg := range trade.Legs {
+		copied := *leg
+		view.Legs[role] = &copied
+	}
+	for role, fee := range trade.Fees {
+		copied := *fee
+		if fee.Leg != nil {
+			leg := *fee.Leg
+			copied.Leg = &leg
+		}
+		view.Fees[role] = &copied
+	}
+	for i, transition := range trade.History {
+		view.History[i] = *transition
+	}
+	return &view
+}
+
+// decodeAdminRequest decodes the POST body into v, writes error response on failure.
+func (s *Service) decodeAdminRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		handleSimpleResponse(w, http.StatusMethodNotAllowed, "method not allowed.")
+		return false
+	}
+
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(v)
+	if err != nil {
+		s.log(r.Context()).Info("server.admin.decodeAdminRequest: json decoder failure.", zap.Error(err))
+		decoderFailure(w, err, http.StatusBadRequest, "json decoder failure.")
+		return false
+	}
+	return true
+}
+
+// isSuspended reports whether the account was suspended by an operator.
+// Caller must hold s.mu.
+func (s *Service) isSuspended(accountName string) bool {
+	_, ok := s.suspended[accountName]
+	return ok
+}
+
+// isHalted reports whether trading of the token was halted by an operator.
+// Caller must hold s.mu.
+func (s *Service) isHalted(token string) bool {
+	_, ok := s.halted[token]
+	return ok
+}
+
+// AdminOffersHandle lists resting offers and offers waiting for settlement, oldest first.
+// Query: token, account, direction and state filter the list.
+func (s *Service) AdminOffersHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.admin.AdminOffersHandle: received new request.")
+
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	token, account, direction, state := query.Get("token"), query.Get("account"), query.Get("direction"), query.Get("state")
+
+	offers := make([]*AdminOffer, 0)
+	add := func(offer *UserOffer, offerDirection string, offerState string) {
+		if (token != "" && offer.Token != token) || (account != "" && offer.AccountName != account) ||
+			(direction != "" && offerDirection != direction) || (state != "" && offerState != state) {
+			return
+		}
+		offers = append(offers, &AdminOffer{Direction: offerDirection, State: offerState, CreatedAt: offer.createdAt, Offer: offer})
+	}
+
+	s.mu.Lock()
+	for _, offer := range s.buyOffers {
+		add(offer, "BUY", OfferStateOpen)
+	}
+	for _, offer := range s.sellOffers {
+		add(offer, "SELL", OfferStateOpen)
+	}
+	for _, match := range s.pendingSettlements {
+		add(match.BuyOffer, "BUY", OfferStatePendingSettlement)
+		add(match.SellOffer, "SELL", OfferStatePendingSettlement)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(offers, func(i, j int) bool {
+		return offers[i].CreatedAt.Before(offers[j].CreatedAt)
+	})
+
+	handleJSONResponse(w, http.StatusOK, offers)
+}
+
+// AdminCancelOfferHandle removes the resting offer of the account and notifies the account.
+func (s *Service) AdminCancelOfferHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.admin.AdminCancelOfferHandle: received new request.")
+
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	var req CancelOfferRequest
+	if !s.decodeAdminRequest(w, r, &req) {
+		return
+	}
+
+	if req.Direction != "BUY" && req.Direction != "SELL" {
+		handleSimpleResponse(w, http.StatusBadRequest, "'direction' must be BUY or SELL.")
+		return
+	}
+	if req.Reason == "" {
+		handleSimpleResponse(w, http.StatusBadRequest, "'reason' is missing.")
+		return
+	}
+
+	s.mu.Lock()
+	book := s.buyOffers
+	if req.Direction == "SELL" {
+		book = s.sellOffers
+	}
+	_, ok := book[req.AccountName]
+	delete(book, req.AccountName)
+	s.mu.Unlock()
+
+	if !ok {
+		s.log(ctx).Info("server.admin.AdminCancelOfferHandle: offer not found.", zap.String("account", req.AccountName))
+		handleSimpleResponse(w, http.StatusNotFound, "offer not found.")
+		return
+	}
+
+	s.notify(req.AccountName, "", "your "+req.Direction+" offer was cancelled by an operator: "+req.Reason)
+	s.audit(AuditAdminPrincipal, AuditAdminOfferCancel, "", &req, "CANCELLED")
+
+	s.log(ctx).Info("server.admin.AdminCancelOfferHandle: offer cancelled.", zap.String("account", req.AccountName))
+	handleSimpleResponse(w, http.StatusOK, "offer cancelled.")
+}
+
+// AdminTradesHandle lists trades, newest first.
+// Query: state, account, token and settlement filter the list.
+func (s *Service) AdminTradesHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.admin.AdminTradesHandle: received new request.")
+
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	state, account, token, settlement := query.Get("state"), query.Get("account"), query.Get("token"), query.Get("settlement")
+
+	trades := make([]*AdminTrade, 0)
+
+	s.mu.Lock()
+	for _, trade := range s.trades {
+		if (state != "" && string(trade.State) != state) ||
+			(account != "" && trade.BuyOffer.AccountName != account && trade.SellOffer.AccountName != account) ||
+			(token != "" && trade.BuyOffer.Token != token) || (settlement != "" && trade.Settlement != settlement) {
+			continue
+		}
+		trades = append(trades, adminTrade(trade))
+	}
+	s.mu.Unlock()
+
+	sort.Slice(trades, func(i, j int) bool {
+		return trades[i].CreatedAt.After(trades[j].CreatedAt)
+	})
+
+	handleJSONResponse(w, http.StatusOK, trades)
+}
+
+// AdminTradeHandle shows the trade given by the 'id' query parameter with its state history.
+func (s *Service) AdminTradeHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.admin.AdminTradeHandle: received new request.")
+
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+
+	s.mu.Lock()
+	trade, ok := s.trades[id]
+	var view *AdminTrade
+	if ok {
+		view = adminTrade(trade)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		s.log(ctx).Info("server.admin.AdminTradeHandle: trade not found.", zap.String("trade", id))
+		handleSimpleResponse(w, http.StatusNotFound, "trade not found.")
+		return
+	}
+
+	handleJSONResponse(w, http.StatusOK, view)
+}
+
+// AdminTradeStateHandle forces the trade into the state, the reason is kept in the trade history.
+// Fees are refunded or collected as if the trade got there on its own. COMPLETED and CANCELLED trades
+// are finished, forcing them elsewhere is refused with 409.
+func (s *Service) AdminTradeStateHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.admin.AdminTradeStateHandle: received new request.")
+
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	var req ForceTradeStateRequest
+	if !s.decodeAdminRequest(w, r, &req) {
+		return
+	}
+
+	if !tradeStates[req.State] {
+		handleSimpleResponse(w, http.StatusBadRequest, "unknown trade state.")
+		return
+	}
+	if req.Reason == "" {
+		handleSimpleResponse(w, http.StatusBadRequest, "'reason' is missing.")
+		return
+	}
+
+	s.mu.Lock()
+	trade, ok := s.trades[req.TradeID]
+	var state TradeState
+	var finished bool
+	if ok {
+		state, finished = trade.State, trade.isFinished()
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		s.log(ctx).Info("server.admin.AdminTradeStateHandle: trade not found.", zap.String("trade", req.TradeID))
+		handleSimpleResponse(w, http.StatusNotFound, "trade not found.")
+		return
+	}
+	if finished {
+		s.log(ctx).Info("server.admin.AdminTradeStateHandle: trade is finished.", zap.String("trade", req.TradeID), zap.String("state", string(state)))
+		handleSimpleResponse(w, http.StatusConflict, "trade is "+string(state)+", finished trades can not change state.")
+		return
+	}
+	if state == req.State {
+		handleSimpleResponse(w, http.StatusConflict, "trade is already "+string(state)+".")
+		return
+	}
+
+	if !s.transitionTradeFrom(trade, state, req.State, AuditAdminPrincipal, req.Reason) {
+		s.log(ctx).Info("server.admin.AdminTradeStateHandle: trade state changed meanwhile.", zap.String("trade", req.TradeID))
+		handleSimpleResponse(w, http.StatusConflict, "trade state changed meanwhile, please check the trade again.")
+		return
+	}
+
+	msg := "trade was moved to " + string(req.State) + " by an operator: " + req.Reason
+	s.notify(trade.BuyOffer.AccountName, trade.ID, msg)
+	s.notify(trade.SellOffer.AccountName, trade.ID, msg)
+
+	handleSimpleResponse(w, http.StatusOK, "trade state changed.")
+}
+
+// AdminRetryHandle repeats a failed saga step of the trade, see RetryStepPayment and RetryStepDispute.
+func (s *Service) AdminRetryHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.admin.AdminRetryHandle: received new request.")
+
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	var req RetryStepRequest
+	if !s.decodeAdminRequest(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	trade, ok := s.trades[req.TradeID]
+	var state TradeState
+	var settled bool
+	if ok {
+		state, settled = trade.State, trade.isSettled()
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		s.log(ctx).Info("server.admin.AdminRetryHandle: trade not found.", zap.String("trade", req.TradeID))
+		handleSimpleResponse(w, http.StatusNotFound, "trade not found.")
+		return
+	}
+
+	addLogFields(ctx, zap.String("tradeId", trade.ID))
+
+	if trade.Settlement != SettlementBisq {
+		handleSimpleResponse(w, http.StatusBadRequest, "only bisq trades have steps to retry.")
+		return
+	}
+
+	var err error
+	switch req.Step {
+	case RetryStepPayment:
+		if !settled || !s.claimPayment(trade) {
+			handleSimpleResponse(w, http.StatusConflict, "trade is not waiting for bisq payment confirmation.")
+			return
+		}
+		err = s.confirmPayment(ctx, trade, AuditAdminPrincipal, req.Reason)
+	case RetryStepDispute:
+		if state != TradeStateDisputed && state != TradeStateCancelled {
+			handleSimpleResponse(w, http.StatusConflict, "trade is not disputed or cancelled.")
+			return
+		}
+		err = s.openBisqDispute(ctx, trade)
+	default:
+		handleSimpleResponse(w, http.StatusBadRequest, "'step' must be payment or dispute.")
+		return
+	}
+
+	if err != nil {
+		s.log(ctx).Error("server.admin.AdminRetryHandle: retry failure.", zap.String("step", req.Step), zap.Error(err))
+		s.audit(AuditAdminPrincipal, AuditAdminRetry, trade.ID, &req, "FAILED: "+err.Error())
+		handleSimpleResponse(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	s.audit(AuditAdminPrincipal, AuditAdminRetry, trade.ID, &req, "OK")
+	handleSimpleResponse(w, http.StatusOK, "step completed.")
+}
+
+// AdminSuspendHandle suspends or reinstates the account. Suspended account can not authenticate
+// and its resting offers are cancelled, trades in progress go on.
+func (s *Service) AdminSuspendHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.admin.AdminSuspendHandle: received new request.")
+
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	var req SuspendAccountRequest
+	if !s.decodeAdminRequest(w, r, &req) {
+		return
+	}
+
+	if req.AccountName == "" || req.Reason == "" {
+		handleSimpleResponse(w, http.StatusBadRequest, "'accountName' and 'reason' are required.")
+		return
+	}
+
+	s.mu.Lock()
+	_, ok := s.credentials[req.AccountName]
+	if ok && req.Suspended {
+		s.suspended[req.AccountName] = req.Reason
+		delete(s.buyOffers, req.AccountName)
+		delete(s.sellOffers, req.AccountName)
+	} else if ok {
+		delete(s.suspended, req.AccountName)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		s.log(ctx).Info("server.admin.AdminSuspendHandle: account not found.", zap.String("account", req.AccountName))
+		handleSimpleResponse(w, http.StatusNotFound, "account not found.")
+		return
+	}
+
+	state := "REINSTATED"
+	if req.Suspended {
+		state = "SUSPENDED"
+	}
+	s.audit(AuditAdminPrincipal, AuditAdminAccountSuspend, "", &req, state)
+
+	s.log(ctx).Info("server.admin.AdminSuspendHandle: account updated.", zap.String("account", req.AccountName), zap.String("state", state))
+	handleSimpleResponse(w, http.StatusOK, "account "+req.AccountName+" is "+state+".")
+}
+
+// AdminHaltHandle halts or resumes trading of the token. Halted market refuses new offers,
+// the book and trades in progress are kept.
+func (s *Service) AdminHaltHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.admin.AdminHaltHandle: received new request.")
+
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	var req HaltMarketRequest
+	if !s.decodeAdminRequest(w, r, &req) {
+		return
+	}
+
+	_, err := s.markets.market(req.Token)
+	if err != nil {
+		handleSimpleResponse(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if req.Reason == "" {
+		handleSimpleResponse(w, http.StatusBadRequest, "'reason' is missing.")
+		return
+	}
+
+	s.mu.Lock()
+	if req.Halted {
+		s.halted[req.Token] = req.Reason
+	} else {
+		delete(s.halted, req.Token)
+	}
+	s.mu.Unlock()
+
+	state := "RESUMED"
+	if req.Halted {
+		state = "HALTED"
+	}
+	s.audit(AuditAdminPrincipal, AuditAdminMarketHalt, "", &req, state)
+
+	s.log(ctx).Info("server.admin.AdminHaltHandle: market updated.", zap.String("token", req.Token), zap.String("state", state))
+	handleSimpleResponse(w, http.StatusOK, "market "+req.Token+" is "+state+".")
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bisq-add-on/money"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testAdminKey = "admin-key"
+
+func adminRequest(t *testing.T, s *Service, handler http.HandlerFunc, req interface{}) int {
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/admin", strings.NewReader(string(body)))
+	r.Header.Set("Authorization", "Bearer "+testAdminKey)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w.Code
+}
+
+func ledgerEntries(s *Service, tradeID string, kind string) int {
+	s.ledger.mu.Lock()
+	defer s.ledger.mu.Unlock()
+
+	count := 0
+	for _, entry := range s.ledger.entries {
+		if entry.TradeID == tradeID && entry.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+func TestAdminTradeStateKeepsFinishedTrades(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestService(t, "http://127.0.0.1:1", dir)
+	s.config.AdminKeyHashes = []string{hashAPIKey(testAdminKey)}
+
+	trade := testBisqTrade("forced")
+	trade.Fees = map[string]*TradeFee{
+		TradeRoleBuyer: {Collection: FeeCollectionDeposit, Token: "BTC", Amount: money.MustParse("0.0001")},
+	}
+	s.mu.Lock()
+	s.indexTrade(trade)
+	s.mu.Unlock()
+
+	force := func(state TradeState) int {
+		return adminRequest(t, s, s.AdminTradeStateHandle, &ForceTradeStateRequest{TradeID: trade.ID, State: state, Reason: "test"})
+	}
+
+	for _, state := range []TradeState{TradeStateDisputed, TradeStatePending, TradeStateDisputed, TradeStateCancelled} {
+		if code := force(state); code != http.StatusOK {
+			t.Fatalf("forcing %s: status = %d, want %d", state, code, http.StatusOK)
+		}
+	}
+	if code := force(TradeStateCancelled); code != http.StatusConflict {
+		t.Fatalf("forcing the current state: status = %d, want %d", code, http.StatusConflict)
+	}
+	for _, state := range []TradeState{TradeStatePending, TradeStateCompleted} {
+		if code := force(state); code != http.StatusConflict {
+			t.Fatalf("forcing cancelled trade to %s: status = %d, want %d", state, code, http.StatusConflict)
+		}
+	}
+
+	if state := tradeState(s, trade); state != TradeStateCancelled {
+		t.Fatalf("state = %s, want %s", state, TradeStateCancelled)
+	}
+	stats := testStats(s, trade.BuyOffer.AccountName)
+	if stats.Disputes != 1 || stats.Cancellations != 1 || stats.CompletedTrades != 0 {
+		t.Fatalf("disputes = %d, cancellations = %d, completed = %d, want 1, 1, 0", stats.Disputes, stats.Cancellations, stats.CompletedTrades)
+	}
+	if n := ledgerEntries(s, trade.ID, LedgerFeeRefunded); n != 1 {
+		t.Fatalf("fee refunds = %d, want 1", n)
+	}
+	if n := ledgerEntries(s, trade.ID, LedgerFeeCollected); n != 0 {
+		t.Fatalf("fee collections = %d, want 0", n)
+	}
+}
+
+func TestAdminRequiresAdminKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestService(t, "http://127.0.0.1:1", dir)
+	s.config.AdminKeyHashes = []string{hashAPIKey("another-key")}
+
+	code := adminRequest(t, s, s.AdminTradeStateHandle, &ForceTradeStateRequest{TradeID: "any", State: TradeStateCancelled, Reason: "test"})
+	if code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
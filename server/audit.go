@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bisq-add-on/audit"
+	"go.uber.org/zap"
+)
+
+// Audited operations.
+const (
+	AuditAccountRegister   = "account.register"
+	AuditWalletVerify      = "wallet.verify"
+	AuditOfferCreate       = "offer.create"
+	AuditOfferMatch        = "offer.match"
+	AuditTransactionSubmit = "transaction.submit"
+	AuditDisputeMessage    = "dispute.message"
+	AuditTradeState        = "trade.state"
+	AuditSelfTrade         = "offer.self_trade"
+	// AuditBisqCall is prefixed to the name of the state-changing Bisq call, e.g. "bisq.PublishOffer".
+	AuditBisqCall = "bisq."
+)
+
+// audit appends the operation to the audit log.
+// Failing to write the log does not fail the operation, it is reported as an error.
+func (s *Service) audit(principal string, operation string, tradeID string, payload interface{}, state string, calls ...string) {
+	if s.auditLog == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		Principal: principal,
+		Operation: operation,
+		TradeID:   tradeID,
+		State:     state,
+		Calls:     calls,
+	}
+	if payload != nil {
+		entry.PayloadDigest = audit.Digest(payload)
+	}
+
+	_, err := s.auditLog.Append(entry)
+	if err != nil {
+		s.logger.Error(
+			"server.audit.audit: audit log append failure.",
+			zap.String("operation", operation),
+			zap.String("trade", tradeID),
+			zap.Error(err),
+		)
+	}
+}
+
+// auditMatch records the trade opened by the match, the taker is the principal.
+func (s *Service) auditMatch(trade *Trade, match *Match, calls ...string) {
+	taker := TradeRoleBuyer
+	if match.Maker == TradeRoleBuyer {
+		taker = TradeRoleSeller
+	}
+	s.audit(trade.account(taker), AuditOfferMatch, trade.ID, match, string(trade.State), calls...)
+}
+
+// auditCall records the state-changing Bisq call and its outcome.
+func (s *Service) auditCall(tradeID string, name string, payload interface{}, err error) {
+	state := "OK"
+	if err != nil {
+		state = "FAILED: " + err.Error()
+	}
+	s.audit(audit.SystemPrincipal, AuditBisqCall+name, tradeID, payload, state, AuditBisqCall+name)
+}
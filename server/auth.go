@@ -0,0 +1,203 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const apiKeyLength = 32
+
+var (
+	errMissingCredentials = errors.New("missing credentials")
+	errInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Credential binds an account name to the hash of its API key.
+// The key itself is returned once on registration and never stored.
+type Credential struct {
+	AccountName string
+	KeyHash     string
+	CreatedAt   time.Time
+}
+
+type RegisterRequest struct {
+	AccountName string `json:"accountName"`
+}
+
+type RegisterResponse struct {
+	AccountName string `json:"accountName"`
+	APIKey      string `json:"apiKey"`
+}
+
+func generateAPIKey() (string, error) {
+	buf := make([]byte, apiKeyLength)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// RegisterHandle creates a new account and returns its API key.
+// Every other endpoint expects the key in the "Authorization: Bearer <key>" header.
+func (s *Service) RegisterHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.auth.RegisterHandle: received new request.")
+
+	var req RegisterRequest
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(&req)
+	if err != nil {
+		s.log(ctx).Error("server.auth.RegisterHandle: json decoder failure.", zap.Error(err))
+		decoderFailure(w, err, http.StatusInternalServerError, "json decoder failure.")
+		return
+	}
+
+	if req.AccountName == "" {
+		s.log(ctx).Info("server.auth.RegisterHandle: 'accountName' is missing.")
+		handleSimpleResponse(w, http.StatusBadRequest, "'accountName' is missing.")
+		return
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		s.log(ctx).Error("server.auth.RegisterHandle: generating api key failure.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusInternalServerError, "generating api key failure.")
+		return
+	}
+
+	credential := Credential{
+		AccountName: req.AccountName,
+		KeyHash:     hashAPIKey(key),
+		CreatedAt:   time.Now(),
+	}
+
+	s.mu.Lock()
+	if _, ok := s.credentials[req.AccountName]; ok {
+		s.mu.Unlock()
+		s.log(ctx).Info("server.auth.RegisterHandle: account already exists.", zap.String("account", req.AccountName))
+		handleSimpleResponse(w, http.StatusConflict, "account already exists.")
+		return
+	}
+	s.credentials[credential.AccountName] = &credential
+	s.apiKeys[credential.KeyHash] = credential.AccountName
+	s.mu.Unlock()
+
+	s.log(ctx).Info("server.auth.RegisterHandle: account registered successfully.", zap.String("account", req.AccountName))
+	s.audit(credential.AccountName, AuditAccountRegister, "", &req, "REGISTERED")
+
+	resp := RegisterResponse{
+		AccountName: credential.AccountName,
+		APIKey:      key,
+	}
+	handleJSONResponse(w, http.StatusOK, &resp)
+}
+
+// authenticate resolves the account name of the principal that sent the request,
+// by the client certificate if it is mapped to an account, otherwise by the API key.
+func (s *Service) authenticate(r *http.Request) (string, error) {
+	if accountName, ok := s.certificateAccount(r); ok {
+		return accountName, nil
+	}
+
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", errMissingCredentials
+	}
+
+	key := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	if key == "" {
+		return "", errMissingCredentials
+	}
+
+	s.mu.Lock()
+	accountName, ok := s.apiKeys[hashAPIKey(key)]
+	s.mu.Unlock()
+
+	if !ok {
+		return "", errInvalidCredentials
+	}
+
+	return accountName, nil
+}
+
+// requirePrincipal authenticates the request and writes 401 response on failure,
+// 403 response when the account is suspended or 429 response when the principal is over its rate limit.
+func (s *Service) requirePrincipal(w http.ResponseWriter, r *http.Request) (string, bool) {
+	principal, err := s.authenticate(r)
+	if err != nil {
+		s.log(r.Context()).Info("server.auth.requirePrincipal: authentication failure.", zap.Error(err))
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		handleSimpleResponse(w, http.StatusUnauthorized, err.Error())
+		return "", false
+	}
+
+	addLogFields(r.Context(), zap.String("principal", principal))
+
+	s.mu.Lock()
+	suspended := s.isSuspended(principal)
+	s.mu.Unlock()
+	if suspended {
+		s.log(r.Context()).Info("server.auth.requirePrincipal: account is suspended.")
+		handleSimpleResponse(w, http.StatusForbidden, "account is suspended.")
+		return "", false
+	}
+
+	if !s.limitAccount(w, r, principal) {
+		return "", false
+	}
+	return principal, true
+}
+
+// requireAdmin authenticates admin requests by keys whose hashes are listed in config.
+// Admin keys are separate from account keys and can not be registered through the API.
+func (s *Service) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	header := r.Header.Get("Authorization")
+	key := strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	if !strings.HasPrefix(header, "Bearer ") || key == "" {
+		s.log(r.Context()).Info("server.auth.requireAdmin: authentication failure.", zap.Error(errMissingCredentials))
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		handleSimpleResponse(w, http.StatusUnauthorized, errMissingCredentials.Error())
+		return false
+	}
+
+	hash := hashAPIKey(key)
+	for _, adminHash := range s.config.AdminKeyHashes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(strings.ToLower(adminHash))) == 1 {
+			return true
+		}
+	}
+
+	s.log(r.Context()).Info("server.auth.requireAdmin: authentication failure.", zap.Error(errInvalidCredentials))
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	handleSimpleResponse(w, http.StatusUnauthorized, errInvalidCredentials.Error())
+	return false
+}
+
+// requireOwner rejects requests that touch resources of an account other than the principal.
+func (s *Service) requireOwner(w http.ResponseWriter, principal string, accountName string) bool {
+	if principal != accountName {
+		s.logger.Info(
+			"server.auth.requireOwner: access to foreign account rejected.",
+			zap.String("principal", principal),
+			zap.String("account", accountName),
+		)
+		handleSimpleResponse(w, http.StatusForbidden, "access to another account is forbidden.")
+		return false
+	}
+
+	return true
+}
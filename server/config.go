@@ -1,3 +1,165 @@
 package server
 
+import (
+	"bisq-add-on/api"
+	"bisq-add-on/money"
+	"encoding/json"
+	"io/ioutil"
+	"time"
+)
 
+// Duration is time.Duration that is read from config as a string, e.g. "30m".
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return err
+	}
+
+	d.Duration, err = time.ParseDuration(s)
+	return err
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+type Config struct {
+	ListenAddr string `json:"listenAddr"`
+
+	// SwapTimeout is the time both parties of a token swap have to submit their transfers.
+	SwapTimeout Duration `json:"swapTimeout"`
+	// SettlementCheckInterval is how often pending settlements are checked for deadlines.
+	SettlementCheckInterval Duration `json:"settlementCheckInterval"`
+	// DeadlineWarning is how long before the trade deadline both sides are warned.
+	DeadlineWarning Duration `json:"deadlineWarning"`
+	// ReconcileInterval is how often local state is reconciled with Bisq.
+	ReconcileInterval Duration `json:"reconcileInterval"`
+	// MinConfirmations is how many blocks a transfer needs on top of it to settle a leg.
+	MinConfirmations int `json:"minConfirmations"`
+
+	PriceOracle PriceOracleConfig `json:"priceOracle"`
+
+	// Markets are the tokens the service trades.
+	Markets []Market `json:"markets"`
+
+	// FeeWallet receives fees collected in the token.
+	FeeWallet string `json:"feeWallet"`
+	// DepositLimits are Bisq limits of the buyer security deposit.
+	DepositLimits DepositLimits `json:"depositLimits"`
+
+	// BisqURL is the Bisq node API, https for a node behind a reverse proxy.
+	BisqURL string        `json:"bisqURL"`
+	BisqTLS BisqTLSConfig `json:"bisqTLS"`
+
+	TLS TLSConfig `json:"tls"`
+
+	// UpstreamTimeout limits every call to Bisq, Ethplorer and price feeds.
+	UpstreamTimeout Duration `json:"upstreamTimeout"`
+	// CircuitBreakers are keyed by upstream: "bisq", "ethplorer" or "feed".
+	CircuitBreakers map[string]CircuitBreakerConfig `json:"circuitBreakers"`
+	// UpstreamRetries is how many times GET calls to Bisq, Ethplorer and price feeds are repeated
+	// when no response was received.
+	UpstreamRetries int `json:"upstreamRetries"`
+
+	RateLimits RateLimitConfig `json:"rateLimits"`
+	// SelfTradePrevention is SelfTradeCancelNewest, SelfTradeCancelOldest or SelfTradeCancelBoth.
+	SelfTradePrevention string `json:"selfTradePrevention"`
+
+	// ShutdownTimeout is how long running settlements are waited for on shutdown.
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+
+	// HealthCheckTimeout limits each readiness check.
+	HealthCheckTimeout Duration `json:"healthCheckTimeout"`
+	// HealthCheckCacheTTL is how long a readiness result is served before checks run again,
+	// so probe traffic does not reach upstreams on every request.
+	HealthCheckCacheTTL Duration `json:"healthCheckCacheTTL"`
+	// EthplorerProbeInterval is how often readiness calls Ethplorer when no other call to it succeeded meanwhile.
+	EthplorerProbeInterval Duration `json:"ethplorerProbeInterval"`
+
+	// AuditLogPath is the hash-chained audit log, empty disables it.
+	AuditLogPath string `json:"auditLogPath"`
+
+	// AdminKeyHashes are hex SHA-256 hashes of the keys admin endpoints accept.
+	AdminKeyHashes []string `json:"adminKeyHashes"`
+
+	Logging LoggingConfig `json:"logging"`
+}
+
+// CircuitBreakerConfig is api.BreakerConfig as it is read from config.
+type CircuitBreakerConfig struct {
+	FailureThreshold int      `json:"failureThreshold"`
+	OpenTimeout      Duration `json:"openTimeout"`
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		ListenAddr:              ":8080",
+		SwapTimeout:             Duration{2 * time.Hour},
+		SettlementCheckInterval: Duration{time.Minute},
+		DeadlineWarning:         Duration{time.Hour},
+		ReconcileInterval:       Duration{5 * time.Minute},
+		MinConfirmations:        12,
+		HealthCheckTimeout:      Duration{2 * time.Second},
+		HealthCheckCacheTTL:     Duration{10 * time.Second},
+		EthplorerProbeInterval:  Duration{time.Minute},
+		ShutdownTimeout:         Duration{30 * time.Second},
+		SelfTradePrevention:     SelfTradeCancelNewest,
+		RateLimits: RateLimitConfig{
+			PerIP:         RateLimit{Rate: 5, Burst: 20},
+			PerAccount:    RateLimit{Rate: 1, Burst: 10},
+			MaxOpenOffers: 2,
+			MaxBodyBytes:  64 << 10,
+		},
+		PriceOracle: PriceOracleConfig{
+			MinSources: 1,
+			CacheTTL:   Duration{30 * time.Second},
+			MaxAge:     Duration{10 * time.Minute},
+		},
+		Markets:         DefaultMarkets(),
+		AuditLogPath:    "audit.log",
+		BisqURL:         api.BisqAPIURL,
+		TLS:             TLSConfig{ReloadInterval: Duration{time.Minute}},
+		UpstreamRetries: 2,
+		UpstreamTimeout: Duration{30 * time.Second},
+		CircuitBreakers: map[string]CircuitBreakerConfig{
+			api.UpstreamBisq:      {FailureThreshold: 5, OpenTimeout: Duration{30 * time.Second}},
+			api.UpstreamEthplorer: {FailureThreshold: 5, OpenTimeout: Duration{30 * time.Second}},
+		},
+		DepositLimits: DepositLimits{
+			MinRatio:  money.MustParse("0.15"),
+			MaxRatio:  money.MustParse("0.5"),
+			MinAmount: money.MustParse("0.006"),
+		},
+		Logging: LoggingConfig{
+			Level:    "info",
+			Format:   LogFormatJSON,
+			Sampling: LogSampling{Initial: 100, Thereafter: 100},
+		},
+	}
+}
+
+// LoadConfig reads JSON config from path on top of the defaults.
+// Empty path returns the default config.
+func LoadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+	if path == "" {
+		return config, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
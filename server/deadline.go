@@ -0,0 +1,124 @@
+package server
+
+import (
+	"bisq-add-on/audit"
+	"context"
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+// isAwaitingPayment reports whether the trade still waits for transfers.
+func (t *Trade) isAwaitingPayment() bool {
+	return t.State == TradeStatePending || t.State == TradeStatePartiallySettled
+}
+
+// hasConfirmedLeg reports whether any transfer of the trade was confirmed.
+func (t *Trade) hasConfirmedLeg() bool {
+	for _, leg := range t.Legs {
+		if leg.Confirmed {
+			return true
+		}
+	}
+	return false
+}
+
+// watchDeadlines periodically warns about approaching trade deadlines and expires overdue trades.
+func (s *Service) watchDeadlines() {
+	ticker := time.NewTicker(s.config.SettlementCheckInterval.Duration)
+	defer ticker.Stop()
+	defer s.jobs.Done()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.checkDeadlines(s.jobContext("deadlines"), time.Now())
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Service) checkDeadlines(ctx context.Context, now time.Time) {
+	var warn, expired []*Trade
+
+	s.mu.Lock()
+	for _, trade := range s.trades {
+		if !trade.isAwaitingPayment() || trade.Deadline.IsZero() {
+			continue
+		}
+
+		if now.After(trade.Deadline) {
+			expired = append(expired, trade)
+			continue
+		}
+
+		if !trade.Warned && trade.Deadline.Sub(now) <= s.config.DeadlineWarning.Duration {
+			trade.Warned = true
+			warn = append(warn, trade)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, trade := range warn {
+		msg := fmt.Sprintf("trade deadline is at %s.", trade.Deadline.Format(time.RFC3339))
+		s.notify(trade.BuyOffer.AccountName, trade.ID, msg)
+		s.notify(trade.SellOffer.AccountName, trade.ID, msg)
+	}
+
+	for _, trade := range expired {
+		err := s.expireTrade(ctx, trade)
+		if err != nil {
+			s.log(ctx).Error("server.deadline.checkDeadlines: server.expireTrade failure.", zap.Error(err))
+		}
+	}
+}
+
+// expireTrade handles trade whose deadline passed without settlement.
+// Trade nobody paid for is cancelled, trade with payments in flight goes to dispute.
+// Token swaps always go to dispute, since no escrow can be released for them.
+// Bisq trades change state only once the Bisq dispute is open, until then the trade
+// keeps awaiting payment and the next check retries it.
+func (s *Service) expireTrade(ctx context.Context, trade *Trade) error {
+	s.log(ctx).Info("server.deadline.expireTrade: trade deadline passed.", zap.String("trade", trade.ID))
+
+	s.mu.Lock()
+	paid := trade.hasConfirmedLeg()
+	s.mu.Unlock()
+
+	state := TradeStateDisputed
+	if trade.Settlement == SettlementBisq && !paid {
+		state = TradeStateCancelled
+	}
+
+	if trade.Settlement == SettlementBisq {
+		// bisq can not cancel a taken offer, seller gets the escrow back through mediation.
+		err := s.openBisqDispute(ctx, trade)
+		if err != nil {
+			s.log(ctx).Error("server.deadline.expireTrade: server.openBisqDispute failure.")
+			return err
+		}
+	}
+
+	// a transfer confirmed during the Bisq call may have settled the trade meanwhile.
+	s.mu.Lock()
+	var transition *TradeTransition
+	if trade.isAwaitingPayment() {
+		transition = s.recordTransition(trade, state, audit.SystemPrincipal, "")
+	}
+	s.mu.Unlock()
+
+	if transition == nil {
+		s.log(ctx).Info("server.deadline.expireTrade: trade is no longer awaiting payment.", zap.String("trade", trade.ID))
+		return nil
+	}
+
+	s.recordTimeouts(trade)
+	s.transitionEffects(trade, transition)
+
+	msg := "trade deadline passed, trade is " + string(state) + "."
+	s.notify(trade.BuyOffer.AccountName, trade.ID, msg)
+	s.notify(trade.SellOffer.AccountName, trade.ID, msg)
+
+	return nil
+}
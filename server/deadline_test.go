@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testBisqTrade(id string) *Trade {
+	return newTrade(testMatch(), &api.TradeDetails{ID: id})
+}
+
+func tradeState(s *Service, trade *Trade) TradeState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return trade.State
+}
+
+func TestDeadlineWarnsOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestService(t, "http://127.0.0.1:1", dir)
+	now := time.Now()
+	trade := testBisqTrade("warned")
+	trade.Deadline = now.Add(s.config.DeadlineWarning.Duration / 2)
+	s.mu.Lock()
+	s.indexTrade(trade)
+	s.mu.Unlock()
+
+	s.checkDeadlines(s.jobContext("test"), now)
+	s.checkDeadlines(s.jobContext("test"), now)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, account := range []string{trade.BuyOffer.AccountName, trade.SellOffer.AccountName} {
+		if n := len(s.notifications[account]); n != 1 {
+			t.Errorf("%s notifications = %d, want 1", account, n)
+		}
+	}
+	if trade.State != TradeStatePending {
+		t.Errorf("state = %s, want %s before the deadline", trade.State, TradeStatePending)
+	}
+}
+
+func TestExpiredBisqTradeWaitsForDispute(t *testing.T) {
+	var calls, failing int32 = 0, 1
+	bisq := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != fmt.Sprintf(api.OpenDisputeURL, "expired") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer bisq.Close()
+
+	dir, err := ioutil.TempDir("", "deadline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestService(t, bisq.URL, dir)
+	trade := testBisqTrade("expired")
+	trade.Deadline = time.Now().Add(-time.Second)
+	s.mu.Lock()
+	s.indexTrade(trade)
+	s.mu.Unlock()
+
+	ctx := s.jobContext("test")
+	s.checkDeadlines(ctx, time.Now())
+	if state := tradeState(s, trade); state != TradeStatePending {
+		t.Fatalf("state after failed dispute = %s, want %s", state, TradeStatePending)
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	s.checkDeadlines(ctx, time.Now())
+	if state := tradeState(s, trade); state != TradeStateCancelled {
+		t.Fatalf("state after dispute = %s, want %s for a trade nobody paid", state, TradeStateCancelled)
+	}
+
+	s.checkDeadlines(ctx, time.Now())
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("open dispute calls = %d, want 2", n)
+	}
+	if timeouts := testStats(s, trade.BuyOffer.AccountName).Timeouts; timeouts != 1 {
+		t.Fatalf("buyer timeouts = %d, want 1", timeouts)
+	}
+}
+
+func TestOpenBisqDisputeOnce(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	bisq := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer bisq.Close()
+
+	dir, err := ioutil.TempDir("", "deadline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestService(t, bisq.URL, dir)
+	trade := testBisqTrade("disputed")
+
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			errs <- s.openBisqDispute(s.jobContext("test"), trade)
+		}()
+	}
+	// callers that lost the claim return while the first one waits for Bisq.
+	returned := 0
+	timeout := time.After(2 * time.Second)
+waiting:
+	for returned < cap(errs)-1 {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatal(err)
+			}
+			returned++
+		case <-timeout:
+			break waiting
+		}
+	}
+	close(release)
+	for ; returned < cap(errs); returned++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("open dispute calls = %d, want 1", n)
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bisq-add-on/money"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// DepositTier applies to buyers with reputation of at least MinReputation, see AccountStats.
+type DepositTier struct {
+	MinReputation int          `json:"minReputation"`
+	Ratio         money.Amount `json:"ratio"`
+}
+
+// DepositConfig is the buyer security deposit of a market as a share of the BTC amount.
+// Zero Ratio is the Bisq minimum.
+type DepositConfig struct {
+	Ratio money.Amount  `json:"ratio"`
+	Tiers []DepositTier `json:"tiers"`
+}
+
+// DepositLimits mirror Bisq restrictions of the buyer security deposit.
+type DepositLimits struct {
+	MinRatio money.Amount `json:"minRatio"`
+	MaxRatio money.Amount `json:"maxRatio"`
+	// MinAmount is in BTC, smaller deposits are raised to it.
+	MinAmount money.Amount `json:"minAmount"`
+}
+
+// SecurityDeposit is the deposit of a trade and the tier it was taken from.
+// Tier is the reputation the tier requires.
+type SecurityDeposit struct {
+	Ratio  money.Amount `json:"ratio"`
+	Amount money.Amount `json:"amount"`
+	Tier   int          `json:"tier"`
+}
+
+func (l *DepositLimits) checkRatio(ratio money.Amount) error {
+	if ratio.Cmp(l.MinRatio) < 0 || ratio.Cmp(l.MaxRatio) > 0 {
+		return fmt.Errorf("deposit ratio %s is outside of Bisq limits %s-%s", ratio, l.MinRatio, l.MaxRatio)
+	}
+	return nil
+}
+
+func (l *DepositLimits) validate() error {
+	if l.MinRatio.Sign() <= 0 || l.MaxRatio.Cmp(l.MinRatio) < 0 {
+		return errors.New("deposit limits require 0 < 'minRatio' <= 'maxRatio'")
+	}
+	if l.MinAmount.Sign() < 0 {
+		return errors.New("negative deposit 'minAmount'")
+	}
+	return nil
+}
+
+// validateDeposit checks deposit config of the market against Bisq limits and orders its tiers.
+func validateDeposit(market *Market, limits *DepositLimits) error {
+	deposit := &market.Deposit
+	if deposit.Ratio.IsZero() {
+		deposit.Ratio = limits.MinRatio
+	}
+
+	err := limits.checkRatio(deposit.Ratio)
+	if err != nil {
+		return fmt.Errorf("market %s: %v", market.Token, err)
+	}
+
+	for _, tier := range deposit.Tiers {
+		if tier.MinReputation <= 0 {
+			return fmt.Errorf("market %s: deposit tier requires positive 'minReputation'", market.Token)
+		}
+		err = limits.checkRatio(tier.Ratio)
+		if err != nil {
+			return fmt.Errorf("market %s: deposit tier %d: %v", market.Token, tier.MinReputation, err)
+		}
+	}
+
+	sort.Slice(deposit.Tiers, func(i, j int) bool {
+		return deposit.Tiers[i].MinReputation < deposit.Tiers[j].MinReputation
+	})
+
+	return nil
+}
+
+// securityDeposit returns the deposit of buying amount of BTC in the market.
+// The ratio comes from the highest tier the reputation of the buyer reached, so timeouts and lost disputes
+// take the buyer down again. Empty buyer gets the market default.
+func (s *Service) securityDeposit(market *Market, buyer string, amount money.Amount) (*SecurityDeposit, error) {
+	deposit := SecurityDeposit{Ratio: market.Deposit.Ratio}
+
+	if buyer != "" {
+		s.mu.Lock()
+		reputation := s.reputation(buyer)
+		s.mu.Unlock()
+
+		for _, tier := range market.Deposit.Tiers {
+			if reputation < tier.MinReputation {
+				break
+			}
+			deposit.Ratio, deposit.Tier = tier.Ratio, tier.MinReputation
+		}
+	}
+
+	limits := &s.config.DepositLimits
+	deposit.Amount = amount.Mul(deposit.Ratio).RoundUp(btcDecimals)
+	if deposit.Amount.Cmp(limits.MinAmount) < 0 {
+		deposit.Amount = limits.MinAmount
+	}
+
+	err := s.checkDeposit(&deposit, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &deposit, nil
+}
+
+// checkDeposit validates the deposit against Bisq limits before the offer is published.
+func (s *Service) checkDeposit(deposit *SecurityDeposit, amount money.Amount) error {
+	limits := &s.config.DepositLimits
+
+	if deposit.Amount.Cmp(limits.MinAmount) < 0 {
+		return fmt.Errorf("security deposit %s BTC is below Bisq minimum %s BTC", deposit.Amount, limits.MinAmount)
+	}
+
+	max := amount.Mul(limits.MaxRatio).RoundUp(btcDecimals)
+	if max.Cmp(limits.MinAmount) < 0 {
+		max = limits.MinAmount
+	}
+	if deposit.Amount.Cmp(max) > 0 {
+		return fmt.Errorf("security deposit %s BTC is above Bisq maximum %s BTC", deposit.Amount, max)
+	}
+
+	return s.config.DepositLimits.checkRatio(deposit.Ratio)
+}
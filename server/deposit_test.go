@@ -0,0 +1,54 @@
+package server
+
+import (
+	"bisq-add-on/money"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSecurityDepositTiersFollowReputation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deposit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestService(t, "http://127.0.0.1:1", dir)
+	market := &Market{Token: "ETH", Deposit: DepositConfig{
+		Ratio: money.MustParse("0.3"),
+		Tiers: []DepositTier{{MinReputation: 50, Ratio: money.MustParse("0.15")}},
+	}}
+	err = validateDeposit(market, &s.config.DepositLimits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	trusted := s.accountStats("trusted")
+	trusted.CompletedTrades = 5
+	trusted.updateReputation()
+	late := s.accountStats("late")
+	late.CompletedTrades, late.Timeouts = 10, 2
+	late.updateReputation()
+	s.mu.Unlock()
+
+	tests := []struct {
+		buyer string
+		ratio money.Amount
+		tier  int
+	}{
+		{"", money.MustParse("0.3"), 0},
+		{"trusted", money.MustParse("0.15"), 50},
+		{"late", money.MustParse("0.3"), 0},
+	}
+	for _, test := range tests {
+		deposit, err := s.securityDeposit(market, test.buyer, money.MustParse("1"))
+		if err != nil {
+			t.Fatalf("%q: %v", test.buyer, err)
+		}
+		if deposit.Ratio.Cmp(test.ratio) != 0 || deposit.Tier != test.tier {
+			t.Errorf("%q: ratio = %s, tier = %d, want %s and %d", test.buyer, deposit.Ratio, deposit.Tier, test.ratio, test.tier)
+		}
+	}
+}
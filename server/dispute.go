@@ -0,0 +1,242 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+type DisputeRequest struct {
+	Message string `json:"message"`
+	// TransactionID is an extra transfer to attach as evidence, e.g. one that failed verification.
+	TransactionID string `json:"transactionID"`
+}
+
+type DisputeStatus struct {
+	TradeID               string               `json:"tradeId"`
+	State                 TradeState           `json:"state"`
+	DisputeOpened         bool                 `json:"disputeOpened"`
+	DisputeState          string               `json:"disputeState"`
+	MediatorNodeAddress   string               `json:"mediatorNodeAddress"`
+	ArbitratorNodeAddress string               `json:"arbitratorNodeAddress"`
+	MediationResult       *api.MediationResult `json:"mediationResult"`
+}
+
+// openDispute opens Bisq dispute for the trade once and moves the trade to dispute.
+func (s *Service) openDispute(ctx context.Context, trade *Trade) error {
+	err := s.openBisqDispute(ctx, trade)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	state := trade.State
+	s.mu.Unlock()
+
+	if state != TradeStateDisputed && state != TradeStateCancelled {
+		s.setTradeState(trade, TradeStateDisputed)
+	}
+
+	return nil
+}
+
+// openBisqDispute opens Bisq dispute for the trade unless it is open already, the trade state is kept.
+// DisputeOpened is claimed before the Bisq call, so the deadline watcher and an operator retry open
+// one dispute, and released when the call fails.
+func (s *Service) openBisqDispute(ctx context.Context, trade *Trade) error {
+	s.mu.Lock()
+	opened := trade.DisputeOpened
+	trade.DisputeOpened = true
+	details := trade.Details
+	s.mu.Unlock()
+
+	if opened {
+		return nil
+	}
+
+	err := api.OpenDispute(ctx, s.logger, s.client, details)
+	s.auditCall(trade.ID, "OpenDispute", details.ID, err)
+	if err != nil {
+		s.log(ctx).Error("server.dispute.openBisqDispute: api.OpenDispute failure.")
+
+		s.mu.Lock()
+		trade.DisputeOpened = false
+		s.mu.Unlock()
+
+		return err
+	}
+
+	return nil
+}
+
+// disputeEvidence collects Ethplorer info of every transfer submitted for the trade.
+func (s *Service) disputeEvidence(ctx context.Context, trade *Trade, extraTransactionID string) (string, []api.DisputeAttachment) {
+	var transactionIDs []string
+
+	s.mu.Lock()
+	for _, leg := range trade.Legs {
+		if leg.TransactionID != "" {
+			transactionIDs = append(transactionIDs, leg.TransactionID)
+		}
+	}
+	s.mu.Unlock()
+
+	if extraTransactionID != "" {
+		transactionIDs = append(transactionIDs, extraTransactionID)
+	}
+
+	var lines []string
+	var attachments []api.DisputeAttachment
+	for _, transactionID := range transactionIDs {
+		lines = append(lines, "Ethereum transaction: "+transactionID)
+
+		transactionInfo, err := api.GetTxInfo(ctx, s.logger, s.client, transactionID)
+		if err != nil {
+			s.log(ctx).Error("server.dispute.disputeEvidence: api.GetTxInfo failure.", zap.Error(err))
+			continue
+		}
+
+		data, err := json.Marshal(transactionInfo)
+		if err != nil {
+			s.log(ctx).Error("server.dispute.disputeEvidence: json marshal failure.", zap.Error(err))
+			continue
+		}
+
+		attachments = append(attachments, api.DisputeAttachment{
+			FileName: fmt.Sprintf("ethplorer-%s.json", transactionID),
+			Bytes:    data,
+		})
+	}
+
+	return strings.Join(lines, "\n"), attachments
+}
+
+// DisputeHandle shows dispute of the trade on GET and opens dispute or posts a message to it on POST.
+// Only sides of the trade have access to it.
+func (s *Service) DisputeHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.dispute.DisputeHandle: received new request.")
+
+	principal, ok := s.requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	tradeIDs, ok := r.URL.Query()["trade"]
+	if !ok || len(tradeIDs) == 0 {
+		s.log(ctx).Info("server.dispute.DisputeHandle: 'trade' parameter is missing.")
+		handleSimpleResponse(w, http.StatusBadRequest, "'trade' parameter is missing.")
+		return
+	}
+
+	s.mu.Lock()
+	trade, ok := s.trades[tradeIDs[0]]
+	s.mu.Unlock()
+
+	if !ok || (trade.BuyOffer.AccountName != principal && trade.SellOffer.AccountName != principal) {
+		s.log(ctx).Info("server.dispute.DisputeHandle: trade not found.", zap.String("trade", tradeIDs[0]))
+		handleSimpleResponse(w, http.StatusNotFound, "trade not found.")
+		return
+	}
+
+	addLogFields(ctx, zap.String("tradeId", trade.ID))
+
+	if trade.Settlement != SettlementBisq {
+		s.log(ctx).Info("server.dispute.DisputeHandle: trade is not settled through bisq.", zap.String("trade", trade.ID))
+		handleSimpleResponse(w, http.StatusBadRequest, "disputes are only available for bisq trades.")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.handleDisputeStatus(ctx, w, trade)
+	case http.MethodPost:
+		s.handleDisputeMessage(ctx, w, r, trade, principal)
+	default:
+		handleSimpleResponse(w, http.StatusMethodNotAllowed, "method not allowed.")
+	}
+}
+
+func (s *Service) handleDisputeStatus(ctx context.Context, w http.ResponseWriter, trade *Trade) {
+	result, err := api.GetMediationResult(ctx, s.logger, s.client, s.tradeDetails(trade))
+	if err != nil && err != api.ErrNotFound {
+		s.log(ctx).Error("server.dispute.handleDisputeStatus: api.GetMediationResult failure.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	status := DisputeStatus{
+		TradeID:               trade.ID,
+		State:                 trade.State,
+		DisputeOpened:         trade.DisputeOpened,
+		DisputeState:          trade.Details.DisputeState,
+		MediatorNodeAddress:   trade.Details.MediatorNodeAddress,
+		ArbitratorNodeAddress: trade.Details.ArbitratorNodeAddress,
+		MediationResult:       result,
+	}
+	s.mu.Unlock()
+
+	handleJSONResponse(w, http.StatusOK, &status)
+}
+
+func (s *Service) handleDisputeMessage(ctx context.Context, w http.ResponseWriter, r *http.Request, trade *Trade, principal string) {
+	var req DisputeRequest
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(&req)
+	if err != nil {
+		s.log(ctx).Error("server.dispute.handleDisputeMessage: json decoder failure.", zap.Error(err))
+		decoderFailure(w, err, http.StatusInternalServerError, "json decoder failure.")
+		return
+	}
+
+	if req.TransactionID != "" {
+		req.TransactionID, err = normalizeTransactionID(req.TransactionID)
+		if err != nil {
+			s.log(ctx).Info("server.dispute.handleDisputeMessage: invalid transaction id.", zap.Error(err))
+			handleSimpleResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	s.mu.Lock()
+	completed := trade.State == TradeStateCompleted
+	s.mu.Unlock()
+
+	if completed {
+		s.log(ctx).Info("server.dispute.handleDisputeMessage: trade is completed.", zap.String("trade", trade.ID))
+		handleSimpleResponse(w, http.StatusConflict, "trade is completed.")
+		return
+	}
+
+	err = s.openDispute(ctx, trade)
+	if err != nil {
+		s.log(ctx).Error("server.dispute.handleDisputeMessage: server.openDispute failure.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	evidence, attachments := s.disputeEvidence(ctx, trade, req.TransactionID)
+
+	message := api.DisputeMessage{
+		Message:     strings.TrimSpace(req.Message + "\n\n" + evidence),
+		Attachments: attachments,
+	}
+
+	err = api.PostDisputeMessage(ctx, s.logger, s.client, s.tradeDetails(trade), &message)
+	s.auditCall(trade.ID, "PostDisputeMessage", &message, err)
+	if err != nil {
+		s.log(ctx).Error("server.dispute.handleDisputeMessage: api.PostDisputeMessage failure.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	s.audit(principal, AuditDisputeMessage, trade.ID, &req, string(TradeStateDisputed), "bisq.PostDisputeMessage")
+
+	s.log(ctx).Info("server.dispute.handleDisputeMessage: dispute message posted.", zap.String("trade", trade.ID))
+	handleSimpleResponse(w, http.StatusOK, "dispute message posted successfully.")
+}
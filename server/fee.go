@@ -0,0 +1,228 @@
+package server
+
+import (
+	"bisq-add-on/money"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+)
+
+const (
+	FeeTypePercentage = "PERCENTAGE"
+	FeeTypeFlat       = "FLAT"
+)
+
+const (
+	// FeeCollectionToken fees are transferred in the market token to the fee wallet.
+	FeeCollectionToken = "TOKEN"
+	// FeeCollectionDeposit fees are kept from the Bisq security deposit in BTC.
+	// Token swaps have no deposit, their fees are collected in the token.
+	FeeCollectionDeposit = "DEPOSIT"
+)
+
+const (
+	LiquidityMaker = "MAKER"
+	LiquidityTaker = "TAKER"
+)
+
+// feeCollector is the receiving side of fee legs.
+const feeCollector = "service"
+
+// FeeConfig is a fee charged to one side of the trade, zero value charges nothing.
+type FeeConfig struct {
+	// Type is FeeTypePercentage or FeeTypeFlat.
+	Type string `json:"type"`
+	// Value is percent of the trade for FeeTypePercentage and the amount for FeeTypeFlat.
+	Value money.Amount `json:"value"`
+}
+
+// MarketFees are fees of a market, maker is the resting offer and taker the incoming one.
+type MarketFees struct {
+	Maker FeeConfig `json:"maker"`
+	Taker FeeConfig `json:"taker"`
+	// Collection is FeeCollectionToken (default) or FeeCollectionDeposit.
+	Collection string `json:"collection"`
+}
+
+// TradeFee is what one side of the trade owes the service.
+// Leg is the transfer to the fee wallet, it is nil for fees kept from the deposit.
+type TradeFee struct {
+	Liquidity  string         `json:"liquidity"`
+	Collection string         `json:"collection"`
+	Token      string         `json:"token"`
+	Amount     money.Amount   `json:"amount"`
+	Leg        *SettlementLeg `json:"leg,omitempty"`
+}
+
+func (f *FeeConfig) validate(decimals int) error {
+	switch f.Type {
+	case "":
+		if !f.Value.IsZero() {
+			return errors.New("fee 'value' requires 'type'")
+		}
+	case FeeTypePercentage, FeeTypeFlat:
+		if f.Value.Sign() < 0 {
+			return errors.New("negative fee")
+		}
+		if f.Type != FeeTypeFlat {
+			break
+		}
+		if _, err := f.Value.Units(decimals); err != nil {
+			return fmt.Errorf("flat fee can have at most %d decimals", decimals)
+		}
+	default:
+		return errors.New("unknown fee type " + f.Type)
+	}
+	return nil
+}
+
+func (f *FeeConfig) amount(base money.Amount, decimals int) money.Amount {
+	switch f.Type {
+	case FeeTypePercentage:
+		return base.Mul(f.Value).Shift(-2).RoundUp(decimals)
+	case FeeTypeFlat:
+		return f.Value
+	}
+	return money.Amount{}
+}
+
+func (f *MarketFees) charged() bool {
+	return !f.Maker.Value.IsZero() || !f.Taker.Value.IsZero()
+}
+
+// validateFees checks fee config of the market, fees collected in the token need the fee wallet.
+func validateFees(market *Market, feeWallet string) error {
+	fees := &market.Fees
+	if fees.Collection == "" {
+		fees.Collection = FeeCollectionToken
+	}
+
+	decimals := market.Decimals
+	switch fees.Collection {
+	case FeeCollectionToken:
+		if fees.charged() && feeWallet == "" {
+			return fmt.Errorf("market %s: fees collected in the token require 'feeWallet'", market.Token)
+		}
+	case FeeCollectionDeposit:
+		decimals = btcDecimals
+	default:
+		return fmt.Errorf("market %s: unknown fee collection %s", market.Token, fees.Collection)
+	}
+
+	err := fees.Maker.validate(decimals)
+	if err != nil {
+		return fmt.Errorf("market %s: maker %v", market.Token, err)
+	}
+	err = fees.Taker.validate(decimals)
+	if err != nil {
+		return fmt.Errorf("market %s: taker %v", market.Token, err)
+	}
+
+	return nil
+}
+
+// feeTerms tells how fees of a trade in the market are collected and what they are a share of.
+// Fees in the token are a share of what the buyer pays, fees from the deposit a share of the BTC amount.
+func feeTerms(market *Market, settlement string, amount money.Amount, tokenAmount money.Amount) (string, string, money.Amount, int) {
+	if settlement == SettlementBisq && market.Fees.Collection == FeeCollectionDeposit {
+		return FeeCollectionDeposit, "BTC", amount, btcDecimals
+	}
+	return FeeCollectionToken, market.Token, tokenAmount, market.Decimals
+}
+
+// tradeFees computes fees of both sides of the matched trade.
+func (s *Service) tradeFees(match *Match, settlement string) (map[string]*TradeFee, error) {
+	market, err := s.markets.market(match.BuyOffer.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	collection, token, base, decimals := feeTerms(market, settlement, match.BuyOffer.Amount, match.TokenAmount)
+
+	fees := make(map[string]*TradeFee, 2)
+	for _, side := range []struct {
+		role  string
+		offer *UserOffer
+	}{
+		{TradeRoleBuyer, match.BuyOffer},
+		{TradeRoleSeller, match.SellOffer},
+	} {
+		liquidity, config := LiquidityTaker, market.Fees.Taker
+		if side.role == match.Maker {
+			liquidity, config = LiquidityMaker, market.Fees.Maker
+		}
+
+		amount := config.amount(base, decimals)
+		if amount.IsZero() {
+			continue
+		}
+
+		fee := TradeFee{
+			Liquidity:  liquidity,
+			Collection: collection,
+			Token:      token,
+			Amount:     amount,
+		}
+		if collection == FeeCollectionToken {
+			fee.Leg = &SettlementLeg{
+				From:       side.offer.AccountName,
+				To:         feeCollector,
+				FromWallet: side.offer.EthereumWallet,
+				ToWallet:   s.config.FeeWallet,
+				Token:      token,
+				Amount:     amount,
+			}
+		}
+		fees[side.role] = &fee
+	}
+
+	return fees, nil
+}
+
+// chargeFees attaches fees to the new trade and records them as owed.
+func (s *Service) chargeFees(trade *Trade, match *Match) error {
+	fees, err := s.tradeFees(match, trade.Settlement)
+	if err != nil {
+		s.logger.Error("server.fee.chargeFees: server.tradeFees failure.", zap.Error(err))
+		return err
+	}
+	trade.Fees = fees
+
+	for role, fee := range fees {
+		account := trade.account(role)
+		s.ledger.record(LedgerFeeCharged, trade.ID, fee.Token, fee.Amount, receivableAccount(account), LedgerRevenue)
+	}
+
+	return nil
+}
+
+// collectDepositFees records fees kept from the Bisq deposit of the completed trade once Bisq paid it out,
+// until then they stay receivable. The reconciler calls it again when it sees the payout transaction.
+func (s *Service) collectDepositFees(trade *Trade) {
+	s.mu.Lock()
+	paidOut := trade.State == TradeStateCompleted && trade.Details != nil && trade.Details.PayoutTxID != ""
+	collect := paidOut && !trade.DepositFeesCollected
+	if collect {
+		trade.DepositFeesCollected = true
+	}
+	s.mu.Unlock()
+
+	if !collect {
+		return
+	}
+
+	for role, fee := range trade.Fees {
+		if fee.Collection != FeeCollectionDeposit {
+			continue
+		}
+		s.ledger.record(LedgerFeeCollected, trade.ID, fee.Token, fee.Amount, LedgerBisqTreasury, receivableAccount(trade.account(role)))
+	}
+}
+
+// refundFees reverses fees of the cancelled trade.
+// Fees that were already paid leave the receivable negative, which is what the service owes back.
+func (s *Service) refundFees(trade *Trade) {
+	for role, fee := range trade.Fees {
+		s.ledger.record(LedgerFeeRefunded, trade.ID, fee.Token, fee.Amount, LedgerRevenue, receivableAccount(trade.account(role)))
+	}
+}
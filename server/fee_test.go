@@ -0,0 +1,41 @@
+package server
+
+import (
+	"bisq-add-on/money"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDepositFeesCollectedOnPayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fee")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestService(t, "http://127.0.0.1:1", dir)
+	trade := testBisqTrade("deposit")
+	trade.Fees = map[string]*TradeFee{
+		TradeRoleBuyer:  {Collection: FeeCollectionDeposit, Token: "BTC", Amount: money.MustParse("0.0001")},
+		TradeRoleSeller: {Collection: FeeCollectionDeposit, Token: "BTC", Amount: money.MustParse("0.0002")},
+	}
+	s.mu.Lock()
+	s.indexTrade(trade)
+	s.mu.Unlock()
+
+	s.setTradeState(trade, TradeStateCompleted)
+	if n := ledgerEntries(s, trade.ID, LedgerFeeCollected); n != 0 {
+		t.Fatalf("collections before payout = %d, want 0", n)
+	}
+
+	s.mu.Lock()
+	trade.Details.PayoutTxID = "payout"
+	s.mu.Unlock()
+
+	s.collectDepositFees(trade)
+	s.collectDepositFees(trade)
+	if n := ledgerEntries(s, trade.ID, LedgerFeeCollected); n != 2 {
+		t.Fatalf("collections after payout = %d, want one per fee", n)
+	}
+}
@@ -2,90 +2,369 @@ package server
 
 import (
 	"bisq-add-on/api"
+	"bisq-add-on/audit"
+	"bisq-add-on/money"
 	"encoding/json"
+	"errors"
 	"go.uber.org/zap"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
 )
 
 type Service struct {
+	config *Config
 	logger *zap.Logger
 	client *http.Client
 	mu     *sync.Mutex
 
+	priceOracle PriceOracle
+	markets     marketRegistry
+
 	buyOffers  map[string]*UserOffer
 	sellOffers map[string]*UserOffer
-	accounts   map[string]*api.PaymentAccount
+	accounts   map[accountKey]*api.PaymentAccount
+	// accountLookups are payment account lookups in progress, see paymentAccount.
+	accountLookups map[accountKey]*accountLookup
 
-	buyTrades  map[string]*api.TradeDetails
-	sellTrades map[string]*api.TradeDetails
+	trades     map[string]*Trade
+	buyTrades  map[string]*Trade
+	sellTrades map[string]*Trade
 
-	matchedBuyAccounts  map[string]string
-	matchedSellAccounts map[string]string
+	transactionIDs map[string]string
 
-	ethereumWallets map[string]string
-	transactionIDs  map[string]string
-}
+	credentials map[string]*Credential
+	apiKeys     map[string]string
+	// suspended and halted map suspended accounts and halted market tokens to the operator's reason.
+	suspended map[string]string
+	halted    map[string]string
+
+	walletChallenges map[string]*WalletChallenge
+	walletOwners     map[string]string
+
+	notifications map[string][]*Notification
+	stats         map[string]*AccountStats
+
+	publishedOffers map[string]string
+	createdAccounts map[string]string
+	lastReconcile   *ReconcileReport
+
+	ledger   *ledger
+	auditLog *audit.Log
+	metrics  *metrics
 
-func initLogger() *zap.Logger {
-	logger, _ := zap.NewDevelopment()
-	return logger
+	dependencies   *dependencies
+	breakers       map[string]*api.Breaker
+	readinessCache readinessCache
+
+	certs *certReloader
+
+	ipLimiter      *limiter
+	accountLimiter *limiter
+
+	// pendingSettlements are Bisq matches made while Bisq was unavailable, oldest first.
+	pendingSettlements []*Match
+
+	// settlements are running Bisq call sequences by registration number.
+	settlements    map[int]*settlement
+	nextSettlement int
+	closing        bool
+	// done stops background jobs, jobs waits for them.
+	done chan struct{}
+	jobs sync.WaitGroup
 }
 
-func InitService() *Service {
+func InitService(config *Config) (*Service, error) {
+	logger, err := newLogger(&config.Logging)
+	if err != nil {
+		return nil, err
+	}
+
 	s := Service{
-		logger: initLogger(),
-		client: api.InitClient(),
+		config: config,
+		logger: logger,
+		client: api.InitClient(config.UpstreamTimeout.Duration),
 		mu:     &sync.Mutex{},
 
 		buyOffers:  make(map[string]*UserOffer),
 		sellOffers: make(map[string]*UserOffer),
-		accounts:   make(map[string]*api.PaymentAccount),
+		accounts:   make(map[accountKey]*api.PaymentAccount),
+
+		accountLookups: make(map[accountKey]*accountLookup),
+
+		trades:     make(map[string]*Trade),
+		buyTrades:  make(map[string]*Trade),
+		sellTrades: make(map[string]*Trade),
+
+		transactionIDs: make(map[string]string),
+
+		credentials: make(map[string]*Credential),
+		apiKeys:     make(map[string]string),
+		suspended:   make(map[string]string),
+		halted:      make(map[string]string),
+
+		walletChallenges: make(map[string]*WalletChallenge),
+		walletOwners:     make(map[string]string),
+
+		notifications: make(map[string][]*Notification),
+		stats:         make(map[string]*AccountStats),
+
+		publishedOffers: make(map[string]string),
+		createdAccounts: make(map[string]string),
+
+		ledger:       &ledger{},
+		dependencies: newDependencies(api.UpstreamBisq, api.UpstreamEthplorer),
+
+		ipLimiter:      newLimiter(config.RateLimits.PerIP),
+		accountLimiter: newLimiter(config.RateLimits.PerAccount),
+
+		settlements: make(map[int]*settlement),
+		done:        make(chan struct{}),
+	}
+
+	api.BisqAPIURL = strings.TrimSuffix(config.BisqURL, "/")
+	if config.BisqTLS != (BisqTLSConfig{}) {
+		err = api.WithTLS(s.client, api.TLSOptions{
+			CAFile:   config.BisqTLS.CAFile,
+			CertFile: config.BisqTLS.CertFile,
+			KeyFile:  config.BisqTLS.KeyFile,
+		})
+		if err != nil {
+			s.logger.Error("server.handles.InitService: api.WithTLS failure.", zap.Error(err))
+			return nil, err
+		}
+	}
 
-		buyTrades:  make(map[string]*api.TradeDetails),
-		sellTrades: make(map[string]*api.TradeDetails),
+	s.metrics = newMetrics(&s)
+	instrumentClient(s.client, s.metrics, s.dependencies, config.UpstreamRetries)
+
+	s.breakers, err = newBreakers(config.CircuitBreakers)
+	if err != nil {
+		s.logger.Error("server.handles.InitService: invalid circuit breakers.", zap.Error(err))
+		return nil, err
+	}
+	api.WithBreakers(s.client, s.breakers)
 
-		matchedBuyAccounts:  make(map[string]string),
-		matchedSellAccounts: make(map[string]string),
+	err = validateSelfTradePrevention(config.SelfTradePrevention)
+	if err != nil {
+		s.logger.Error("server.handles.InitService: invalid self-trade prevention.", zap.Error(err))
+		return nil, err
+	}
 
-		ethereumWallets: make(map[string]string),
-		transactionIDs:  make(map[string]string),
+	err = config.RateLimits.validate()
+	if err != nil {
+		s.logger.Error("server.handles.InitService: invalid rate limits.", zap.Error(err))
+		return nil, err
 	}
 
-	return &s
+	markets, err := newMarketRegistry(config.Markets)
+	if err != nil {
+		s.logger.Error("server.handles.InitService: server.newMarketRegistry failure.", zap.Error(err))
+		return nil, err
+	}
+	s.markets = markets
+
+	if config.FeeWallet != "" {
+		config.FeeWallet, err = normalizeWallet(config.FeeWallet)
+		if err != nil {
+			s.logger.Error("server.handles.InitService: invalid fee wallet.", zap.Error(err))
+			return nil, err
+		}
+	}
+	if config.AuditLogPath != "" {
+		s.auditLog, err = audit.Open(config.AuditLogPath)
+		if err != nil {
+			s.logger.Error("server.handles.InitService: audit.Open failure.", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	err = config.DepositLimits.validate()
+	if err != nil {
+		s.logger.Error("server.handles.InitService: invalid deposit limits.", zap.Error(err))
+		return nil, err
+	}
+	for _, market := range s.markets {
+		err = validateFees(market, config.FeeWallet)
+		if err != nil {
+			s.logger.Error("server.handles.InitService: server.validateFees failure.", zap.Error(err))
+			return nil, err
+		}
+		err = validateDeposit(market, &config.DepositLimits)
+		if err != nil {
+			s.logger.Error("server.handles.InitService: server.validateDeposit failure.", zap.Error(err))
+			return nil, err
+		}
+	}
+
+	priceOracle, err := newPriceOracle(&config.PriceOracle, s.markets, s.logger, s.client)
+	if err != nil {
+		s.logger.Error("server.handles.InitService: server.newPriceOracle failure.", zap.Error(err))
+		return nil, err
+	}
+	s.priceOracle = priceOracle
+
+	if config.TLS.CertFile != "" || config.TLS.KeyFile != "" {
+		if config.TLS.ReloadInterval.Duration <= 0 {
+			err = errors.New("tls reload interval must be positive")
+			s.logger.Error("server.handles.InitService: invalid tls config.", zap.Error(err))
+			return nil, err
+		}
+		s.certs, err = newCertReloader(config.TLS.CertFile, config.TLS.KeyFile)
+		if err != nil {
+			s.logger.Error("server.handles.InitService: loading certificate failure.", zap.Error(err))
+			return nil, err
+		}
+		s.jobs.Add(1)
+		go s.watchCertificates()
+	} else if config.TLS.ClientCAFile != "" {
+		err = errors.New("client certificates require tls certificate and key")
+		s.logger.Error("server.handles.InitService: invalid tls config.", zap.Error(err))
+		return nil, err
+	}
+
+	// certificate accounts can not be registered with a key by someone else.
+	for _, accountName := range config.TLS.ClientAccounts {
+		s.credentials[accountName] = &Credential{AccountName: accountName, CreatedAt: time.Now()}
+	}
+
+	s.jobs.Add(3)
+	go s.watchDeadlines()
+	go s.runReconciler()
+	go s.runPendingSettlements()
+
+	return &s, nil
 }
 
 type UserOffer struct {
 	AccountName string `json:"accountName"`
 	Token       string `json:"token"`
 
-	Price     int64  `json:"price"`
-	Amount    int64  `json:"amount"`
-	Direction string `json:"direction"`
+	Price     money.Amount `json:"price"`
+	Amount    money.Amount `json:"amount"`
+	Direction string       `json:"direction"`
+
+	// PriceType is PriceTypeFixed (default) or PriceTypeMarket. Market-based offers are priced by
+	// the price oracle at match time, the Bisq offer of the match is published at that fixed price.
+	PriceType string `json:"priceType"`
+	// MarketMargin is the distance from market price in percent for PriceTypeMarket offers.
+	MarketMargin float64 `json:"marketMargin"`
 
 	EthereumWallet string `json:"ethereumWallet"`
+
+	// Settlement is SettlementBisq (default) or SettlementTokenSwap.
+	Settlement string `json:"settlement"`
+	// CounterToken is the token seller transfers to buyer in a token swap.
+	CounterToken string `json:"counterToken"`
+
+	// MinReputation is the lowest reputation of the counterparty the offer matches with.
+	MinReputation int `json:"minReputation"`
+
+	createdAt time.Time
 }
 
 func (s *Service) BuyHandle(w http.ResponseWriter, r *http.Request) {
-	s.logger.Info("server.handles.BuyHandle: received new request.")
+	ctx := r.Context()
+	s.log(ctx).Info("server.handles.BuyHandle: received new request.")
+
+	if s.isClosing() {
+		s.log(ctx).Info("server.handles.BuyHandle: service is shutting down.")
+		handleSimpleResponse(w, http.StatusServiceUnavailable, "service is shutting down.")
+		return
+	}
+
+	principal, ok := s.requirePrincipal(w, r)
+	if !ok {
+		return
+	}
 
 	var offer UserOffer
 	dec := json.NewDecoder(r.Body)
 	err := dec.Decode(&offer)
 	if err != nil {
-		s.logger.Error("server.handles.BuyHandle: json decoder failure.", zap.Error(err))
-		handleSimpleResponse(w, http.StatusInternalServerError, "json decoder failure.")
+		s.log(ctx).Error("server.handles.BuyHandle: json decoder failure.", zap.Error(err))
+		decoderFailure(w, err, http.StatusInternalServerError, "json decoder failure.")
 		return
 	}
 
-	matched, err := s.matchOffers(&offer)
+	if offer.AccountName == "" {
+		offer.AccountName = principal
+	}
+	if !s.requireOwner(w, principal, offer.AccountName) {
+		return
+	}
+
+	s.mu.Lock()
+	verified := s.isWalletVerified(offer.AccountName, offer.EthereumWallet)
+	s.mu.Unlock()
+	if !verified {
+		s.log(ctx).Info("server.handles.BuyHandle: ethereum wallet is not verified.", zap.String("account", offer.AccountName))
+		handleSimpleResponse(w, http.StatusForbidden, "ethereum wallet is not verified.")
+		return
+	}
+	offer.EthereumWallet = strings.ToLower(offer.EthereumWallet)
+
+	err = normalizeOffer(&offer, s.markets)
+	if err != nil {
+		s.log(ctx).Info("server.handles.BuyHandle: invalid offer.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	halted := s.isHalted(offer.Token)
+	s.mu.Unlock()
+	if halted {
+		s.log(ctx).Info("server.handles.BuyHandle: market is halted.", zap.String("token", offer.Token))
+		handleSimpleResponse(w, http.StatusServiceUnavailable, "trading of "+offer.Token+" is halted.")
+		return
+	}
+
+	err = s.validateOfferPrice(ctx, &offer)
+	if err != nil {
+		s.log(ctx).Info("server.handles.BuyHandle: invalid offer price.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = s.checkOfferCaps(ctx, &offer, "BUY")
+	if errors.Is(err, errOfferCap) {
+		s.log(ctx).Info("server.handles.BuyHandle: offer caps exceeded.", zap.Error(err))
+		s.metrics.rateLimited.WithLabelValues("offers").Inc()
+		tooManyRequests(w, offerCapRetryAfter, err.Error())
+		return
+	}
+	if err != nil {
+		s.log(ctx).Error("server.handles.BuyHandle: server.checkOfferCaps failure.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusServiceUnavailable, "offer caps can not be checked: "+err.Error())
+		return
+	}
+
+	offer.createdAt = time.Now()
+	s.metrics.offers.WithLabelValues("BUY", offer.Token).Inc()
+
+	matched, err := s.matchOffers(ctx, &offer)
+	if err == errSelfTrade {
+		s.log(ctx).Info("server.handles.BuyHandle: offer cancelled by self-trade prevention.")
+		s.audit(principal, AuditOfferCreate, "", &offer, "CANCELLED: "+err.Error())
+		handleSimpleResponse(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err == errSettlementPending {
+		s.audit(principal, AuditOfferCreate, "", &offer, "PENDING_SETTLEMENT")
+		handleSimpleResponse(w, http.StatusAccepted, "Your offer was matched, settlement is pending until Bisq is available.")
+		return
+	}
 	if err != nil {
-		s.logger.Error("server.handles.BuyHandle: server.matchOffers failure.")
+		s.log(ctx).Error("server.handles.BuyHandle: server.matchOffers failure.")
+		s.audit(principal, AuditOfferCreate, "", &offer, "FAILED: "+err.Error())
 		handleSimpleResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	if matched {
+		s.audit(principal, AuditOfferCreate, "", &offer, "MATCHED")
 		handleSimpleResponse(w, http.StatusOK, "Your offer was matched successfully.")
 		return
 	}
@@ -94,29 +373,112 @@ func (s *Service) BuyHandle(w http.ResponseWriter, r *http.Request) {
 	s.buyOffers[offer.AccountName] = &offer
 	s.mu.Unlock()
 
+	s.audit(principal, AuditOfferCreate, "", &offer, "SAVED")
+
 	handleSimpleResponse(w, http.StatusOK, "Your offer was saved successfully.")
 }
 
 func (s *Service) SellHandle(w http.ResponseWriter, r *http.Request) {
-	s.logger.Info("server.handles.SellHandle: received new request.")
+	ctx := r.Context()
+	s.log(ctx).Info("server.handles.SellHandle: received new request.")
+
+	if s.isClosing() {
+		s.log(ctx).Info("server.handles.SellHandle: service is shutting down.")
+		handleSimpleResponse(w, http.StatusServiceUnavailable, "service is shutting down.")
+		return
+	}
+
+	principal, ok := s.requirePrincipal(w, r)
+	if !ok {
+		return
+	}
 
 	var offer UserOffer
 	dec := json.NewDecoder(r.Body)
 	err := dec.Decode(&offer)
 	if err != nil {
-		s.logger.Error("server.handles.SellHandle: json decoder failure.", zap.Error(err))
-		handleSimpleResponse(w, http.StatusInternalServerError, "json decoder failure.")
+		s.log(ctx).Error("server.handles.SellHandle: json decoder failure.", zap.Error(err))
+		decoderFailure(w, err, http.StatusInternalServerError, "json decoder failure.")
+		return
+	}
+
+	if offer.AccountName == "" {
+		offer.AccountName = principal
+	}
+	if !s.requireOwner(w, principal, offer.AccountName) {
+		return
+	}
+
+	s.mu.Lock()
+	verified := s.isWalletVerified(offer.AccountName, offer.EthereumWallet)
+	s.mu.Unlock()
+	if !verified {
+		s.log(ctx).Info("server.handles.SellHandle: ethereum wallet is not verified.", zap.String("account", offer.AccountName))
+		handleSimpleResponse(w, http.StatusForbidden, "ethereum wallet is not verified.")
+		return
+	}
+	offer.EthereumWallet = strings.ToLower(offer.EthereumWallet)
+
+	err = normalizeOffer(&offer, s.markets)
+	if err != nil {
+		s.log(ctx).Info("server.handles.SellHandle: invalid offer.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	halted := s.isHalted(offer.Token)
+	s.mu.Unlock()
+	if halted {
+		s.log(ctx).Info("server.handles.SellHandle: market is halted.", zap.String("token", offer.Token))
+		handleSimpleResponse(w, http.StatusServiceUnavailable, "trading of "+offer.Token+" is halted.")
+		return
+	}
+
+	err = s.validateOfferPrice(ctx, &offer)
+	if err != nil {
+		s.log(ctx).Info("server.handles.SellHandle: invalid offer price.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	matched, err := s.matchOffers(&offer)
+	err = s.checkOfferCaps(ctx, &offer, "SELL")
+	if errors.Is(err, errOfferCap) {
+		s.log(ctx).Info("server.handles.SellHandle: offer caps exceeded.", zap.Error(err))
+		s.metrics.rateLimited.WithLabelValues("offers").Inc()
+		tooManyRequests(w, offerCapRetryAfter, err.Error())
+		return
+	}
 	if err != nil {
-		s.logger.Error("server.handles.SellHandle: server.matchOffers failure.")
+		s.log(ctx).Error("server.handles.SellHandle: server.checkOfferCaps failure.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusServiceUnavailable, "offer caps can not be checked: "+err.Error())
+		return
+	}
+
+	offer.createdAt = time.Now()
+	s.metrics.offers.WithLabelValues("SELL", offer.Token).Inc()
+
+	matched, err := s.matchOffers(ctx, &offer)
+	if err == errSelfTrade {
+		s.log(ctx).Info("server.handles.SellHandle: offer cancelled by self-trade prevention.")
+		s.audit(principal, AuditOfferCreate, "", &offer, "CANCELLED: "+err.Error())
+		handleSimpleResponse(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err == errSettlementPending {
+		s.audit(principal, AuditOfferCreate, "", &offer, "PENDING_SETTLEMENT")
+		handleSimpleResponse(w, http.StatusAccepted, "Your offer was matched, settlement is pending until Bisq is available.")
+		return
+	}
+	if err != nil {
+		s.log(ctx).Error("server.handles.SellHandle: server.matchOffers failure.")
+		s.audit(principal, AuditOfferCreate, "", &offer, "FAILED: "+err.Error())
 		handleSimpleResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	if matched {
+		s.audit(principal, AuditOfferCreate, "", &offer, "MATCHED")
 		handleSimpleResponse(w, http.StatusOK, "Your offer was matched successfully.")
 		return
 	}
@@ -125,73 +487,147 @@ func (s *Service) SellHandle(w http.ResponseWriter, r *http.Request) {
 	s.sellOffers[offer.AccountName] = &offer
 	s.mu.Unlock()
 
+	s.audit(principal, AuditOfferCreate, "", &offer, "SAVED")
+
 	handleSimpleResponse(w, http.StatusOK, "Your offer was saved successfully.")
 }
 
-func (s *Service) CheckOfferHandle(w http.ResponseWriter, r *http.Request) {
-	s.logger.Info("server.handles.CheckOfferHandle: received new request.")
+type MoneySentRequest struct {
+	TransactionID string `json:"transactionID"`
+}
+
+// MoneySentHandle confirms the transfer the account owes in its active trade, "trade" picks one by ID.
+// With "fee=true" the transfer pays the fee of the account instead.
+// Trade completes once every leg is confirmed.
+func (s *Service) MoneySentHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.handles.MoneySentHandle: received new request.")
+
+	principal, ok := s.requirePrincipal(w, r)
+	if !ok {
+		return
+	}
 
 	accountNames, ok := r.URL.Query()["account"]
 	if !ok || len(accountNames) == 0 {
-		s.logger.Info("server.handles.CheckOfferHandle: 'account' parameter is missing.")
+		s.log(ctx).Info("server.handles.MoneySentHandle: 'account' parameter is missing.")
 		handleSimpleResponse(w, http.StatusBadRequest, "'account' parameter is missing.")
 		return
 	}
 	accountName := accountNames[0]
-	counterAccountName := s.matchedSellAccounts[accountName]
-	ethereumWallet := s.ethereumWallets[counterAccountName]
+	if !s.requireOwner(w, principal, accountName) {
+		return
+	}
 
-	handleSimpleResponse(w, http.StatusOK, ethereumWallet)
-}
+	payingFee := r.URL.Query().Get("fee") == "true"
 
-type MoneySentRequest struct {
-	TransactionID string `json:"transactionID"`
-}
+	s.mu.Lock()
+	trade, role, err := s.findTrade(accountName, r.URL.Query().Get("trade"))
+	var leg *SettlementLeg
+	var state TradeState
+	if err == nil {
+		leg = trade.Legs[role]
+		if payingFee {
+			leg = nil
+			if fee, ok := trade.Fees[role]; ok {
+				leg = fee.Leg
+			}
+		}
+		state = trade.State
+	}
+	s.mu.Unlock()
 
-func (s *Service) MoneySentHandle(w http.ResponseWriter, r *http.Request) {
-	s.logger.Info("server.handles.MoneySentHandle: received new request.")
+	if err != nil {
+		s.log(ctx).Info("server.handles.MoneySentHandle: no matched trade.", zap.String("account", accountName), zap.Error(err))
+		handleTradeLookupFailure(w, err)
+		return
+	}
 
-	accountNames, ok := r.URL.Query()["account"]
-	if !ok || len(accountNames) == 0 {
-		s.logger.Info("server.handles.MoneySentHandle: 'account' parameter is missing.")
-		handleSimpleResponse(w, http.StatusBadRequest, "'account' parameter is missing.")
+	addLogFields(ctx, zap.String("tradeId", trade.ID))
+
+	if leg == nil {
+		s.log(ctx).Info("server.handles.MoneySentHandle: no transfer is expected from account.", zap.String("account", accountName))
+		handleSimpleResponse(w, http.StatusBadRequest, "no transfer is expected from this side of the trade.")
+		return
+	}
+
+	if state != TradeStatePending && state != TradeStatePartiallySettled {
+		s.log(ctx).Info("server.handles.MoneySentHandle: trade is not awaiting payment.", zap.String("state", string(state)))
+		handleSimpleResponse(w, http.StatusConflict, "trade is not awaiting payment.")
 		return
 	}
-	accountName := accountNames[0]
-	counterAccountName := s.matchedSellAccounts[accountName]
 
 	var req MoneySentRequest
 	dec := json.NewDecoder(r.Body)
-	err := dec.Decode(&req)
+	err = dec.Decode(&req)
 	if err != nil {
-		s.logger.Error("server.handles.MoneySentHandle: json decoder failure.", zap.Error(err))
-		handleSimpleResponse(w, http.StatusInternalServerError, err.Error())
+		s.log(ctx).Error("server.handles.MoneySentHandle: json decoder failure.", zap.Error(err))
+		decoderFailure(w, err, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	req.TransactionID, err = normalizeTransactionID(req.TransactionID)
+	if err != nil {
+		s.log(ctx).Info("server.handles.MoneySentHandle: invalid transaction id.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	ok, err = s.checkTransaction(req.TransactionID, accountName, counterAccountName)
+	ok, err = s.checkTransaction(ctx, trade, req.TransactionID, leg)
 	if ok && err != nil {
-		s.logger.Error("server.handles.MoneySentHandle: server.checkTransaction failure.")
+		s.log(ctx).Error("server.handles.MoneySentHandle: server.checkTransaction failure.")
 		handleSimpleResponse(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	if !ok && err != nil {
-		s.logger.Error("server.handles.MoneySentHandle: invalid transaction.", zap.Error(err))
+		s.log(ctx).Error("server.handles.MoneySentHandle: invalid transaction.", zap.Error(err))
+		s.audit(principal, AuditTransactionSubmit, trade.ID, &req, "REJECTED: "+err.Error(), "ethplorer.GetTxInfo")
 		handleSimpleResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	s.logger.Info("server.handles.MoneySentHandle: transaction is valid, proceed to finishing trade...")
-
-	err = s.handleSuccessfulTransaction(s.buyTrades[accountName])
+	transition, err := s.confirmLeg(trade, leg, req.TransactionID)
 	if err != nil {
-		s.logger.Error("server.handles.MoneySentHandle: server.handleSuccessfulTransaction failure.", zap.Error(err))
-		handleSimpleResponse(w, http.StatusInternalServerError, err.Error())
+		s.log(ctx).Info("server.handles.MoneySentHandle: leg not confirmed.", zap.String("transaction", req.TransactionID), zap.Error(err))
+		if err == errTransactionReused {
+			s.metrics.rejections.WithLabelValues("reused").Inc()
+		}
+		s.audit(principal, AuditTransactionSubmit, trade.ID, &req, "REJECTED: "+err.Error(), "ethplorer.GetTxInfo")
+		handleSimpleResponse(w, http.StatusConflict, err.Error()+".")
 		return
 	}
+	s.transitionEffects(trade, transition)
+
+	s.mu.Lock()
+	state = trade.State
+	s.mu.Unlock()
+
+	if state == TradeStatePartiallySettled {
+		s.audit(principal, AuditTransactionSubmit, trade.ID, &req, string(TradeStatePartiallySettled), "ethplorer.GetTxInfo")
+		s.log(ctx).Info("server.handles.MoneySentHandle: leg confirmed, waiting for counterparty.")
+		handleSimpleResponse(w, http.StatusOK, "transfer confirmed, waiting for counterparty")
+		return
+	}
+
+	s.log(ctx).Info("server.handles.MoneySentHandle: transaction is valid, proceed to finishing trade...")
+
+	calls := []string{"ethplorer.GetTxInfo"}
+	if state == TradeStatePaymentSent {
+		// confirmLeg claimed the payment for this request.
+		calls = append(calls, "bisq.PaymentStarted", "bisq.PaymentReceived")
+		err = s.confirmPayment(ctx, trade, audit.SystemPrincipal, "")
+		if err != nil {
+			s.log(ctx).Error("server.handles.MoneySentHandle: server.confirmPayment failure.", zap.Error(err))
+			s.audit(principal, AuditTransactionSubmit, trade.ID, &req, "FAILED: "+err.Error(), calls...)
+			handleSimpleResponse(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	s.audit(principal, AuditTransactionSubmit, trade.ID, &req, string(TradeStateCompleted), calls...)
 
-	s.logger.Info("server.handles.MoneySentHandle: trade completed successfully.")
+	s.log(ctx).Info("server.handles.MoneySentHandle: trade completed successfully.")
 	handleSimpleResponse(w, http.StatusOK, "trade completed successfully")
 	return
 }
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Readiness checks.
+const (
+	CheckBisq      = api.UpstreamBisq
+	CheckEthplorer = api.UpstreamEthplorer
+	CheckStorage   = "storage"
+	CheckMatching  = "matching"
+)
+
+// DependencyStatus is what the service saw of an upstream on its recent calls.
+type DependencyStatus struct {
+	Name     string `json:"name"`
+	Calls    int64  `json:"calls"`
+	Failures int64  `json:"failures"`
+	// Latency is the duration of the last call.
+	Latency     Duration   `json:"latency"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	LastErrorAt *time.Time `json:"lastErrorAt,omitempty"`
+	// CircuitBreaker is empty for upstreams without a breaker.
+	CircuitBreaker api.BreakerState `json:"circuitBreaker,omitempty"`
+}
+
+// dependencies collects DependencyStatus from every call made through the instrumented client.
+type dependencies struct {
+	mu     sync.Mutex
+	status map[string]*DependencyStatus
+}
+
+func newDependencies(names ...string) *dependencies {
+	d := dependencies{status: make(map[string]*DependencyStatus)}
+	for _, name := range names {
+		d.status[name] = &DependencyStatus{Name: name}
+	}
+	return &d
+}
+
+// record counts the call, server errors count as failures the same way as transport errors.
+func (d *dependencies) record(name string, latency time.Duration, resp *http.Response, err error) {
+	if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+		err = errors.New("response failure, status = " + strconv.Itoa(resp.StatusCode))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status, ok := d.status[name]
+	if !ok {
+		status = &DependencyStatus{Name: name}
+		d.status[name] = status
+	}
+
+	now := time.Now()
+	status.Calls++
+	status.Latency = Duration{latency}
+	if err != nil {
+		status.Failures++
+		status.LastError = err.Error()
+		status.LastErrorAt = &now
+	} else {
+		status.LastSuccess = &now
+	}
+}
+
+// succeededSince reports whether a call to the upstream succeeded after t.
+func (d *dependencies) succeededSince(name string, t time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status, ok := d.status[name]
+	return ok && status.LastSuccess != nil && status.LastSuccess.After(t)
+}
+
+func (d *dependencies) snapshot() []DependencyStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	snapshot := make([]DependencyStatus, 0, len(d.status))
+	for _, status := range d.status {
+		snapshot = append(snapshot, *status)
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		return snapshot[i].Name < snapshot[j].Name
+	})
+	return snapshot
+}
+
+type ReadinessCheck struct {
+	Name    string   `json:"name"`
+	OK      bool     `json:"ok"`
+	Error   string   `json:"error,omitempty"`
+	Latency Duration `json:"latency"`
+}
+
+type Readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+type ServiceStatus struct {
+	Dependencies       []DependencyStatus `json:"dependencies"`
+	PendingSettlements int                `json:"pendingSettlements"`
+}
+
+// checkMatching fails when the book lock can not be taken in time,
+// i.e. matching is stuck behind a hung call or a deadlock.
+func (s *Service) checkMatching(ctx context.Context) error {
+	locked := make(chan struct{})
+	go func() {
+		s.mu.Lock()
+		s.mu.Unlock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		return errors.New("matching engine is not responding")
+	}
+}
+
+func (s *Service) checkStorage(ctx context.Context) error {
+	if s.auditLog == nil {
+		return nil
+	}
+	return s.auditLog.Check()
+}
+
+func (s *Service) checkBisq(ctx context.Context) error {
+	_, err := api.GetVersion(ctx, s.logger, s.client)
+	return err
+}
+
+// checkEthplorer fails while the Ethplorer breaker is open. Otherwise any Ethplorer call that succeeded
+// within EthplorerProbeInterval tells it is reachable, without one getLastBlock is called at most once
+// per interval: the shared API key is rate limited and transaction verification goes through the same breaker.
+// Runs under readinessCache.mu, see cachedReadiness.
+func (s *Service) checkEthplorer(ctx context.Context) error {
+	breaker, ok := s.breakers[api.UpstreamEthplorer]
+	if ok && breaker.State() == api.BreakerOpen {
+		return api.ErrCircuitOpen
+	}
+
+	interval := s.config.EthplorerProbeInterval.Duration
+	if s.dependencies.succeededSince(api.UpstreamEthplorer, time.Now().Add(-interval)) {
+		return nil
+	}
+
+	cache := &s.readinessCache
+	if !cache.ethplorerProbedAt.IsZero() && time.Since(cache.ethplorerProbedAt) < interval {
+		return cache.ethplorerErr
+	}
+
+	_, err := api.GetLastBlock(ctx, s.logger, s.client)
+	cache.ethplorerErr, cache.ethplorerProbedAt = err, time.Now()
+	return err
+}
+
+// readinessCache keeps the last readiness result for HealthCheckCacheTTL
+// and the last Ethplorer probe for EthplorerProbeInterval.
+type readinessCache struct {
+	mu        sync.Mutex
+	readiness *Readiness
+	checkedAt time.Time
+
+	ethplorerErr      error
+	ethplorerProbedAt time.Time
+}
+
+// cachedReadiness returns the last readiness result while it is fresh, otherwise runs the checks.
+// Concurrent probes wait for one run instead of starting their own.
+func (s *Service) cachedReadiness() *Readiness {
+	s.readinessCache.mu.Lock()
+	defer s.readinessCache.mu.Unlock()
+
+	if s.readinessCache.readiness != nil && time.Since(s.readinessCache.checkedAt) < s.config.HealthCheckCacheTTL.Duration {
+		return s.readinessCache.readiness
+	}
+
+	s.readinessCache.readiness = s.readiness(s.jobContext("readiness"))
+	s.readinessCache.checkedAt = time.Now()
+	return s.readinessCache.readiness
+}
+
+// readiness runs the checks concurrently, each within HealthCheckTimeout.
+func (s *Service) readiness(ctx context.Context) *Readiness {
+	checks := []struct {
+		name  string
+		check func(ctx context.Context) error
+	}{
+		{CheckBisq, s.checkBisq},
+		{CheckEthplorer, s.checkEthplorer},
+		{CheckStorage, s.checkStorage},
+		{CheckMatching, s.checkMatching},
+	}
+
+	readiness := Readiness{Ready: true, Checks: make([]ReadinessCheck, len(checks))}
+
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, s.config.HealthCheckTimeout.Duration)
+			defer cancel()
+
+			start := time.Now()
+			err := checks[i].check(checkCtx)
+
+			result := ReadinessCheck{Name: checks[i].name, OK: err == nil, Latency: Duration{time.Since(start)}}
+			if err != nil {
+				result.Error = err.Error()
+			}
+			readiness.Checks[i] = result
+		}(i)
+	}
+	wg.Wait()
+
+	for _, check := range readiness.Checks {
+		readiness.Ready = readiness.Ready && check.OK
+	}
+	return &readiness
+}
+
+// HealthzHandle reports that the process is alive and serving requests.
+func (s *Service) HealthzHandle(w http.ResponseWriter, r *http.Request) {
+	handleSimpleResponse(w, http.StatusOK, "ok.")
+}
+
+// ReadyzHandle reports whether the service can trade: upstreams are reachable,
+// the audit log is writable and matching is not stuck. Responds 503 when any check fails.
+// Results are cached for HealthCheckCacheTTL.
+func (s *Service) ReadyzHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	readiness := s.cachedReadiness()
+	if !readiness.Ready {
+		for _, check := range readiness.Checks {
+			if !check.OK {
+				s.log(ctx).Warn("server.health.ReadyzHandle: readiness check failure.", zap.String("check", check.Name), zap.String("error", check.Error))
+			}
+		}
+		handleJSONResponse(w, http.StatusServiceUnavailable, readiness)
+		return
+	}
+
+	handleJSONResponse(w, http.StatusOK, readiness)
+}
+
+// StatusHandle shows latency, last error and breaker state of every upstream, for operators only.
+func (s *Service) StatusHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.health.StatusHandle: received new request.")
+
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	status := ServiceStatus{Dependencies: s.dependencies.snapshot()}
+	for i := range status.Dependencies {
+		if breaker, ok := s.breakers[status.Dependencies[i].Name]; ok {
+			status.Dependencies[i].CircuitBreaker = breaker.State()
+		}
+	}
+
+	s.mu.Lock()
+	status.PendingSettlements = len(s.pendingSettlements)
+	s.mu.Unlock()
+
+	handleJSONResponse(w, http.StatusOK, &status)
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+func checkEthplorer(s *Service) error {
+	s.readinessCache.mu.Lock()
+	defer s.readinessCache.mu.Unlock()
+	return s.checkEthplorer(context.Background())
+}
+
+func TestCheckEthplorerProbesOncePerInterval(t *testing.T) {
+	var calls int32
+	ethplorer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		_, _ = w.Write([]byte(`{"lastBlock":1}`))
+	}))
+	defer ethplorer.Close()
+
+	defer func(ethplorerAPI string) {
+		api.EthplorerAPI = ethplorerAPI
+	}(api.EthplorerAPI)
+	api.EthplorerAPI = ethplorer.URL
+
+	dir, err := ioutil.TempDir("", "health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestService(t, "http://bisq.invalid", dir)
+	for i := 0; i < 3; i++ {
+		if err := checkEthplorer(s); err != nil {
+			t.Fatalf("check %d: %v", i, err)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("ethplorer calls = %d, want 1 per probe interval", n)
+	}
+
+	ethplorer.Close()
+	s, _ = newTestService(t, "http://bisq.invalid", dir)
+	if err := checkEthplorer(s); err == nil {
+		t.Fatal("unreachable ethplorer with a closed breaker is ready")
+	}
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"bisq-add-on/money"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of ledger entries.
+const (
+	LedgerFeeCharged   = "FEE_CHARGED"
+	LedgerFeeCollected = "FEE_COLLECTED"
+	LedgerFeeRefunded  = "FEE_REFUNDED"
+	LedgerTradeLeg     = "TRADE_LEG"
+)
+
+// Ledger accounts that do not belong to a user.
+const (
+	// LedgerRevenue is credited with every fee charged.
+	LedgerRevenue = "revenue:fees"
+	// LedgerFeeTreasury is the fee wallet fees in the token are sent to.
+	LedgerFeeTreasury = "treasury:fee-wallet"
+	// LedgerBisqTreasury is the Bisq wallet fees kept from deposits stay in.
+	LedgerBisqTreasury = "treasury:bisq"
+)
+
+func walletAccount(accountName string) string {
+	return "wallet:" + accountName
+}
+
+func receivableAccount(accountName string) string {
+	return "receivable:" + accountName
+}
+
+// LedgerEntry moves Amount of Token from Credit to Debit account.
+// Every entry balances on its own, so the sum over all accounts is always zero.
+type LedgerEntry struct {
+	ID      int          `json:"id"`
+	Time    time.Time    `json:"time"`
+	Kind    string       `json:"kind"`
+	TradeID string       `json:"tradeId"`
+	Token   string       `json:"token"`
+	Amount  money.Amount `json:"amount"`
+	Debit   string       `json:"debit"`
+	Credit  string       `json:"credit"`
+}
+
+// ledger is an append-only double-entry journal.
+type ledger struct {
+	mu      sync.Mutex
+	entries []*LedgerEntry
+}
+
+func (l *ledger) record(kind string, tradeID string, token string, amount money.Amount, debit string, credit string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, &LedgerEntry{
+		ID:      len(l.entries) + 1,
+		Time:    time.Now(),
+		Kind:    kind,
+		TradeID: tradeID,
+		Token:   token,
+		Amount:  amount,
+		Debit:   debit,
+		Credit:  credit,
+	})
+}
+
+// RevenueBucket is fee revenue in one token over one period.
+type RevenueBucket struct {
+	Period   string       `json:"period"`
+	Token    string       `json:"token"`
+	Charged  money.Amount `json:"charged"`
+	Refunded money.Amount `json:"refunded"`
+	Net      money.Amount `json:"net"`
+}
+
+var revenuePeriods = map[string]string{
+	"day":   "2006-01-02",
+	"month": "2006-01",
+	"year":  "2006",
+}
+
+// revenue groups revenue account movements between from and to by period.
+func (l *ledger) revenue(layout string, from time.Time, to time.Time) []*RevenueBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	type key struct{ period, token string }
+	buckets := make(map[key]*RevenueBucket)
+	for _, entry := range l.entries {
+		if entry.Time.Before(from) || (!to.IsZero() && !entry.Time.Before(to)) {
+			continue
+		}
+		if entry.Credit != LedgerRevenue && entry.Debit != LedgerRevenue {
+			continue
+		}
+
+		k := key{entry.Time.UTC().Format(layout), entry.Token}
+		bucket, ok := buckets[k]
+		if !ok {
+			bucket = &RevenueBucket{Period: k.period, Token: k.token}
+			buckets[k] = bucket
+		}
+
+		if entry.Credit == LedgerRevenue {
+			bucket.Charged = bucket.Charged.Add(entry.Amount)
+		} else {
+			bucket.Refunded = bucket.Refunded.Add(entry.Amount)
+		}
+		bucket.Net = bucket.Charged.Sub(bucket.Refunded)
+	}
+
+	result := make([]*RevenueBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		result = append(result, bucket)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Period != result[j].Period {
+			return result[i].Period < result[j].Period
+		}
+		return result[i].Token < result[j].Token
+	})
+
+	return result
+}
+
+// queryTime reads optional RFC3339 time parameter, zero time when it is missing.
+func queryTime(query url.Values, name string) (time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// RevenueHandle reports fee revenue grouped by period for admins.
+// Query: period=day|month|year (default day), from and to as RFC3339 times, to is exclusive.
+func (s *Service) RevenueHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.ledger.RevenueHandle: received new request.")
+
+	if !s.requireAdmin(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+
+	period := query.Get("period")
+	if period == "" {
+		period = "day"
+	}
+	layout, ok := revenuePeriods[period]
+	if !ok {
+		s.log(ctx).Info("server.ledger.RevenueHandle: unknown period.", zap.String("period", period))
+		handleSimpleResponse(w, http.StatusBadRequest, "'period' must be day, month or year.")
+		return
+	}
+
+	from, err := queryTime(query, "from")
+	if err != nil {
+		s.log(ctx).Info("server.ledger.RevenueHandle: invalid 'from'.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusBadRequest, "'from' must be RFC3339 time.")
+		return
+	}
+
+	to, err := queryTime(query, "to")
+	if err != nil {
+		s.log(ctx).Info("server.ledger.RevenueHandle: invalid 'to'.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusBadRequest, "'to' must be RFC3339 time.")
+		return
+	}
+
+	handleJSONResponse(w, http.StatusOK, s.ledger.revenue(layout, from, to))
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	LogFormatJSON    = "json"
+	LogFormatConsole = "console"
+)
+
+const (
+	requestIDLength = 8
+	// maxRequestIDLength limits IDs sent by clients, longer ones are replaced.
+	maxRequestIDLength = 64
+)
+
+// LogSampling keeps the first Initial entries with the same message every second
+// and every Thereafter-th entry after that. Zero Initial disables sampling.
+type LogSampling struct {
+	Initial    int `json:"initial"`
+	Thereafter int `json:"thereafter"`
+}
+
+type LoggingConfig struct {
+	// Level is debug, info, warn or error.
+	Level string `json:"level"`
+	// Format is LogFormatJSON or LogFormatConsole.
+	Format   string      `json:"format"`
+	Sampling LogSampling `json:"sampling"`
+}
+
+func newLogger(config *LoggingConfig) (*zap.Logger, error) {
+	var level zapcore.Level
+	err := level.UnmarshalText([]byte(config.Level))
+	if err != nil {
+		return nil, err
+	}
+
+	var encoder zapcore.Encoder
+	switch config.Format {
+	case LogFormatJSON:
+		encoderConfig := zap.NewProductionEncoderConfig()
+		encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	case LogFormatConsole:
+		encoder = zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+	default:
+		return nil, errors.New("unknown log format " + config.Format)
+	}
+
+	var core zapcore.Core = &redactingCore{zapcore.NewCore(encoder, zapcore.Lock(os.Stderr), level)}
+	if config.Sampling.Initial > 0 {
+		core = zapcore.NewSampler(core, time.Second, config.Sampling.Initial, config.Sampling.Thereafter)
+	}
+
+	return zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)), nil
+}
+
+// secretFields are never logged, walletFields are logged masked.
+// Wallet addresses are masked in every other string field too, e.g. in upstream response bodies.
+var (
+	secretFields = map[string]bool{
+		"apiKey":        true,
+		"key":           true,
+		"signature":     true,
+		"authorization": true,
+		"nonce":         true,
+	}
+	walletFields = map[string]bool{
+		"wallet":         true,
+		"ethereumWallet": true,
+		"fromWallet":     true,
+		"toWallet":       true,
+		"paymentDetails": true,
+		"address":        true,
+	}
+	addressPattern = regexp.MustCompile(`0x[0-9a-fA-F]{40}`)
+)
+
+// mask keeps only the ends of the value, enough to tell wallets apart in logs.
+func mask(value string) string {
+	if len(value) <= 10 {
+		return "[REDACTED]"
+	}
+	return value[:6] + "..." + value[len(value)-4:]
+}
+
+func redact(fields []zapcore.Field) []zapcore.Field {
+	redacted := make([]zapcore.Field, len(fields))
+	for i, field := range fields {
+		switch {
+		case secretFields[field.Key]:
+			field = zap.String(field.Key, "[REDACTED]")
+		case field.Type != zapcore.StringType:
+		case walletFields[field.Key]:
+			field.String = mask(field.String)
+		default:
+			field.String = addressPattern.ReplaceAllStringFunc(field.String, mask)
+		}
+		redacted[i] = field
+	}
+	return redacted
+}
+
+// redactingCore removes secrets and wallet details from fields before they are encoded.
+type redactingCore struct {
+	zapcore.Core
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{c.Core.With(redact(fields))}
+}
+
+func (c *redactingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(entry.Level) {
+		return checked.AddCore(entry, c)
+	}
+	return checked
+}
+
+func (c *redactingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(entry, redact(fields))
+}
+
+type logScopeKey struct{}
+
+// logScope is the logger of a single request or job, fields are added to it as the request
+// learns who the principal is and which trade it touches.
+type logScope struct {
+	mu     sync.Mutex
+	logger *zap.Logger
+}
+
+func newRequestID() string {
+	buf := make([]byte, requestIDLength)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// requestContext tags the context with the request ID for api calls and logs.
+func (s *Service) requestContext(ctx context.Context, requestID string) context.Context {
+	ctx = api.WithRequestID(ctx, requestID)
+	scope := logScope{logger: s.logger.With(zap.String("requestId", requestID))}
+	return context.WithValue(ctx, logScopeKey{}, &scope)
+}
+
+// jobContext is requestContext for work the service starts on its own.
+func (s *Service) jobContext(job string) context.Context {
+	ctx := s.requestContext(context.Background(), newRequestID())
+	addLogFields(ctx, zap.String("job", job))
+	return ctx
+}
+
+// log returns the logger of the request or job the context belongs to.
+func (s *Service) log(ctx context.Context) *zap.Logger {
+	scope, ok := ctx.Value(logScopeKey{}).(*logScope)
+	if !ok {
+		return s.logger
+	}
+
+	scope.mu.Lock()
+	defer scope.mu.Unlock()
+	return scope.logger
+}
+
+// addLogFields adds fields to every later log line of the request.
+func addLogFields(ctx context.Context, fields ...zap.Field) {
+	scope, ok := ctx.Value(logScopeKey{}).(*logScope)
+	if !ok {
+		return
+	}
+
+	scope.mu.Lock()
+	scope.logger = scope.logger.With(fields...)
+	scope.mu.Unlock()
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"bisq-add-on/money"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChainEthereum is the only settlement chain transfers can be verified on, through Ethplorer.
+const ChainEthereum = "ethereum"
+
+// btcDecimals is the precision of BTC amounts of Bisq trades, Bisq keeps them in satoshi.
+const btcDecimals = 8
+
+// Market describes a token the service trades and how it is represented in Bisq.
+type Market struct {
+	// Token is the name offers refer to the token by.
+	Token string `json:"token"`
+
+	MarketPair      string   `json:"marketPair"`
+	TradeCurrencies []string `json:"tradeCurrencies"`
+	CurrencyCode    string   `json:"currencyCode"`
+	PaymentMethod   string   `json:"paymentMethod"`
+
+	// Contract is the ERC20 contract address, empty for the chain's native coin.
+	Contract string `json:"contract"`
+	Decimals int    `json:"decimals"`
+	Chain    string `json:"chain"`
+
+	Fees    MarketFees    `json:"fees"`
+	Deposit DepositConfig `json:"deposit"`
+
+	// MaxNotional caps the token worth of resting offers of an account, zero is no cap.
+	MaxNotional money.Amount `json:"maxNotional"`
+}
+
+func (m *Market) isNative() bool {
+	return m.Contract == ""
+}
+
+// DefaultMarkets is what the service traded before markets became configurable.
+func DefaultMarkets() []Market {
+	return []Market{
+		{
+			Token:           "ETH",
+			MarketPair:      "btc_eth",
+			TradeCurrencies: []string{"BTC", "ETH"},
+			CurrencyCode:    "ETH",
+			PaymentMethod:   "BLOCK_CHAINS",
+			Contract:        "",
+			Decimals:        18,
+			Chain:           ChainEthereum,
+		},
+	}
+}
+
+// marketRegistry maps token to its market.
+type marketRegistry map[string]*Market
+
+func newMarketRegistry(markets []Market) (marketRegistry, error) {
+	registry := make(marketRegistry, len(markets))
+	for i := range markets {
+		market := markets[i]
+
+		if market.Token == "" || market.MarketPair == "" || market.CurrencyCode == "" {
+			return nil, errors.New("market requires 'token', 'marketPair' and 'currencyCode'")
+		}
+		if _, ok := registry[market.Token]; ok {
+			return nil, fmt.Errorf("market %s is configured twice", market.Token)
+		}
+		if market.Chain == "" {
+			market.Chain = ChainEthereum
+		}
+		if market.Chain != ChainEthereum {
+			return nil, fmt.Errorf("market %s: unsupported settlement chain %s", market.Token, market.Chain)
+		}
+		if market.Contract != "" {
+			contract, err := normalizeWallet(market.Contract)
+			if err != nil {
+				return nil, fmt.Errorf("market %s: invalid contract address", market.Token)
+			}
+			market.Contract = contract
+		}
+		if market.PaymentMethod == "" {
+			market.PaymentMethod = "BLOCK_CHAINS"
+		}
+		if len(market.TradeCurrencies) == 0 {
+			market.TradeCurrencies = []string{"BTC", market.CurrencyCode}
+		}
+		if market.Decimals < 0 {
+			return nil, fmt.Errorf("market %s: negative decimals", market.Token)
+		}
+		if market.MaxNotional.Sign() < 0 {
+			return nil, fmt.Errorf("market %s: negative max notional", market.Token)
+		}
+
+		registry[market.Token] = &market
+	}
+
+	return registry, nil
+}
+
+func (r marketRegistry) market(token string) (*Market, error) {
+	market, ok := r[token]
+	if !ok {
+		return nil, fmt.Errorf("unsupported token %s, supported tokens are %s", token, r.tokens())
+	}
+	return market, nil
+}
+
+func (r marketRegistry) tokens() string {
+	tokens := make([]string, 0, len(r))
+	for token := range r {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	return strings.Join(tokens, ", ")
+}
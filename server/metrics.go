@@ -0,0 +1,232 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const metricsNamespace = "bisq_addon"
+
+type metrics struct {
+	registry *prometheus.Registry
+
+	offers        *prometheus.CounterVec
+	matches       *prometheus.CounterVec
+	timeToMatch   *prometheus.HistogramVec
+	timeToSettle  *prometheus.HistogramVec
+	rejections    *prometheus.CounterVec
+	requests      *prometheus.CounterVec
+	requestTime   *prometheus.HistogramVec
+	upstreamCalls *prometheus.CounterVec
+	upstreamTime  *prometheus.HistogramVec
+	retries       *prometheus.CounterVec
+	rateLimited   *prometheus.CounterVec
+	selfTrades    *prometheus.CounterVec
+}
+
+func newMetrics(s *Service) *metrics {
+	m := metrics{
+		registry: prometheus.NewRegistry(),
+		offers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "offers_total",
+			Help:      "Offers placed, by direction and token.",
+		}, []string{"direction", "token"}),
+		matches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "matches_total",
+			Help:      "Matched offer pairs, by token and settlement.",
+		}, []string{"token", "settlement"}),
+		timeToMatch: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "time_to_match_seconds",
+			Help:      "How long resting offers waited in the book before they matched.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 10),
+		}, []string{"token"}),
+		timeToSettle: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "time_to_settle_seconds",
+			Help:      "Time from match to completed trade.",
+			Buckets:   prometheus.ExponentialBuckets(60, 2, 10),
+		}, []string{"settlement"}),
+		rejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "verification_rejections_total",
+			Help:      "Submitted transactions that failed verification, by reason.",
+		}, []string{"reason"}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Handled requests, by route and status code.",
+		}, []string{"route", "code"}),
+		requestTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Request handling latency, by route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route"}),
+		upstreamCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_requests_total",
+			Help:      "Calls to Bisq, Ethplorer and price feeds, by endpoint and status code, \"error\" when no response was received.",
+		}, []string{"upstream", "endpoint", "code"}),
+		upstreamTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_request_duration_seconds",
+			Help:      "Latency of upstream calls, by endpoint.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"upstream", "endpoint"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_retries_total",
+			Help:      "Upstream calls repeated after a failed attempt, by endpoint.",
+		}, []string{"upstream", "endpoint"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rate_limited_total",
+			Help:      "Requests rejected with 429, by limit: \"ip\", \"account\" or \"offers\" for offer caps.",
+		}, []string{"limit"}),
+		selfTrades: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "self_trades_prevented_total",
+			Help:      "Matches prevented because both offers belong to one owner, by what links them.",
+		}, []string{"link"}),
+	}
+
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.offers, m.matches, m.timeToMatch, m.timeToSettle, m.rejections,
+		m.requests, m.requestTime, m.upstreamCalls, m.upstreamTime, m.retries, m.rateLimited, m.selfTrades,
+		&stateCollector{s: s},
+	)
+
+	return &m
+}
+
+var (
+	bookDepthDesc = prometheus.NewDesc(
+		metricsNamespace+"_book_depth", "Resting offers in the book, by direction and token.",
+		[]string{"direction", "token"}, nil,
+	)
+	tradesDesc = prometheus.NewDesc(
+		metricsNamespace+"_trades", "Trades, by state.",
+		[]string{"state"}, nil,
+	)
+)
+
+// stateCollector reads book depth and trade states from the service on every scrape.
+type stateCollector struct {
+	s *Service
+}
+
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bookDepthDesc
+	ch <- tradesDesc
+}
+
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	type depthKey struct{ direction, token string }
+	depth := make(map[depthKey]int)
+	states := make(map[TradeState]int)
+
+	c.s.mu.Lock()
+	for _, offer := range c.s.buyOffers {
+		depth[depthKey{"BUY", offer.Token}]++
+	}
+	for _, offer := range c.s.sellOffers {
+		depth[depthKey{"SELL", offer.Token}]++
+	}
+	for _, trade := range c.s.trades {
+		states[trade.State]++
+	}
+	c.s.mu.Unlock()
+
+	for key, count := range depth {
+		ch <- prometheus.MustNewConstMetric(bookDepthDesc, prometheus.GaugeValue, float64(count), key.direction, key.token)
+	}
+	for state, count := range states {
+		ch <- prometheus.MustNewConstMetric(tradesDesc, prometheus.GaugeValue, float64(count), string(state))
+	}
+}
+
+// MetricsHandler serves the metrics in Prometheus text format.
+func (s *Service) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{})
+}
+
+// statusRecorder remembers the status code the handler wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Instrument wraps the handler of the route with request count and latency metrics.
+// Every request gets an ID, taken from api.RequestIDHeader when the client sent one,
+// which is echoed in the response, added to log lines and forwarded to upstream calls.
+func (s *Service) Instrument(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		requestID := r.Header.Get(api.RequestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestIDLength {
+			requestID = newRequestID()
+		}
+		w.Header().Set(api.RequestIDHeader, requestID)
+
+		handler(recorder, r.WithContext(s.requestContext(r.Context(), requestID)))
+
+		s.metrics.requests.WithLabelValues(route, strconv.Itoa(recorder.status)).Inc()
+		s.metrics.requestTime.WithLabelValues(route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// instrumentedTransport measures upstream calls made through the api package.
+// Idempotent GET requests that got no response are retried up to retries times.
+type instrumentedTransport struct {
+	next         http.RoundTripper
+	metrics      *metrics
+	dependencies *dependencies
+	retries      int
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	upstream, endpoint := api.Upstream(req), api.Endpoint(req)
+
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		resp, err := t.next.RoundTrip(req)
+		latency := time.Since(start)
+		t.metrics.upstreamTime.WithLabelValues(upstream, endpoint).Observe(latency.Seconds())
+		t.dependencies.record(upstream, latency, resp, err)
+
+		if err == nil {
+			t.metrics.upstreamCalls.WithLabelValues(upstream, endpoint, strconv.Itoa(resp.StatusCode)).Inc()
+			return resp, nil
+		}
+
+		t.metrics.upstreamCalls.WithLabelValues(upstream, endpoint, "error").Inc()
+		if req.Method != http.MethodGet || attempt >= t.retries || req.Context().Err() != nil {
+			return nil, err
+		}
+		t.metrics.retries.WithLabelValues(upstream, endpoint).Inc()
+	}
+}
+
+func instrumentClient(client *http.Client, m *metrics, d *dependencies, retries int) {
+	next := client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.Transport = &instrumentedTransport{next: next, metrics: m, dependencies: d, retries: retries}
+}
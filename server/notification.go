@@ -0,0 +1,55 @@
+package server
+
+import (
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// Notification is a message for the account that is delivered on the next poll.
+type Notification struct {
+	TradeID   string    `json:"tradeId"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (s *Service) notify(accountName string, tradeID string, message string) {
+	notification := Notification{
+		TradeID:   tradeID,
+		Message:   message,
+		CreatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	s.notifications[accountName] = append(s.notifications[accountName], &notification)
+	s.mu.Unlock()
+
+	s.logger.Info(
+		"server.notification.notify: new notification.",
+		zap.String("account", accountName),
+		zap.String("trade", tradeID),
+		zap.String("message", message),
+	)
+}
+
+// NotificationsHandle returns pending notifications of the principal and drops them.
+func (s *Service) NotificationsHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.notification.NotificationsHandle: received new request.")
+
+	principal, ok := s.requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	notifications := s.notifications[principal]
+	delete(s.notifications, principal)
+	s.mu.Unlock()
+
+	if notifications == nil {
+		notifications = []*Notification{}
+	}
+
+	handleJSONResponse(w, http.StatusOK, notifications)
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"bisq-add-on/money"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	PriceSourceStatic = "static"
+	PriceSourceFile   = "file"
+	PriceSourceHTTP   = "http"
+	PriceSourceBisq   = "bisq"
+)
+
+type PriceSourceConfig struct {
+	Type string `json:"type"`
+
+	// Prices are served by static source.
+	Prices map[string]money.Amount `json:"prices"`
+	// Path is a JSON file of the form {"<token>": <price>} read by file source.
+	Path string `json:"path"`
+	// URL is a JSON price feed read by http source.
+	URL string `json:"url"`
+	// Scale multiplies Bisq market prices to get prices in UserOffer.Price units.
+	Scale money.Amount `json:"scale"`
+}
+
+type PriceOracleConfig struct {
+	Sources []PriceSourceConfig `json:"sources"`
+	// MinSources is how many sources have to agree for the median to be trusted.
+	MinSources int `json:"minSources"`
+	// CacheTTL is how long quotes are reused before sources are asked again.
+	CacheTTL Duration `json:"cacheTTL"`
+	// MaxAge is how old a quote can be before it is rejected as stale.
+	MaxAge Duration `json:"maxAge"`
+	// MaxDeviation is how far in percent offer prices may be from the market, zero disables the check.
+	MaxDeviation float64 `json:"maxDeviation"`
+}
+
+// staticPriceOracle serves prices from config, they never go stale.
+type staticPriceOracle map[string]money.Amount
+
+func (o staticPriceOracle) Quote(ctx context.Context, token string) (*Quote, error) {
+	price, ok := o[token]
+	if !ok || price.Sign() <= 0 {
+		return nil, errNoMarketPrice
+	}
+	return &Quote{Token: token, Price: price, Time: time.Now(), Source: PriceSourceStatic}, nil
+}
+
+// filePriceOracle reads prices from a JSON file on every call.
+// Quotes are as old as the file, so a file nobody updates goes stale.
+type filePriceOracle struct {
+	path string
+}
+
+func (o *filePriceOracle) Quote(ctx context.Context, token string) (*Quote, error) {
+	info, err := os.Stat(o.path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(o.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var prices map[string]money.Amount
+	err = json.Unmarshal(data, &prices)
+	if err != nil {
+		return nil, err
+	}
+
+	price, ok := prices[token]
+	if !ok || price.Sign() <= 0 {
+		return nil, errNoMarketPrice
+	}
+
+	return &Quote{Token: token, Price: price, Time: info.ModTime(), Source: PriceSourceFile}, nil
+}
+
+// httpPriceOracle reads prices from a JSON feed, see api.GetPriceFeed.
+type httpPriceOracle struct {
+	logger *zap.Logger
+	client *http.Client
+	url    string
+}
+
+func (o *httpPriceOracle) Quote(ctx context.Context, token string) (*Quote, error) {
+	prices, err := api.GetPriceFeed(ctx, o.logger, o.client, o.url)
+	if err != nil {
+		return nil, err
+	}
+
+	price, ok := prices[token]
+	if !ok || price.Price.Sign() <= 0 {
+		return nil, errNoMarketPrice
+	}
+
+	return &Quote{Token: token, Price: price.Price, Time: time.Unix(price.Timestamp, 0), Source: PriceSourceHTTP}, nil
+}
+
+// bisqPriceOracle reads market prices of the Bisq node.
+type bisqPriceOracle struct {
+	logger  *zap.Logger
+	client  *http.Client
+	markets marketRegistry
+	scale   money.Amount
+}
+
+func (o *bisqPriceOracle) Quote(ctx context.Context, token string) (*Quote, error) {
+	market, ok := o.markets[token]
+	if !ok {
+		return nil, errNoMarketPrice
+	}
+
+	prices, err := api.GetMarketPrices(ctx, o.logger, o.client, market.CurrencyCode)
+	if err != nil {
+		return nil, err
+	}
+
+	price, ok := prices[market.CurrencyCode]
+	if !ok || price.Sign() <= 0 {
+		return nil, errNoMarketPrice
+	}
+
+	return &Quote{Token: token, Price: price.Mul(o.scale).RoundUp(priceDecimals), Time: time.Now(), Source: PriceSourceBisq}, nil
+}
+
+// cachingPriceOracle reuses quotes of the wrapped oracle for ttl.
+type cachingPriceOracle struct {
+	next PriceOracle
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	quotes  map[string]*Quote
+	fetched map[string]time.Time
+}
+
+func (o *cachingPriceOracle) Quote(ctx context.Context, token string) (*Quote, error) {
+	o.mu.Lock()
+	quote, ok := o.quotes[token]
+	fetched := o.fetched[token]
+	o.mu.Unlock()
+
+	if ok && time.Since(fetched) < o.ttl {
+		return quote, nil
+	}
+
+	quote, err := o.next.Quote(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	o.quotes[token] = quote
+	o.fetched[token] = time.Now()
+	o.mu.Unlock()
+
+	return quote, nil
+}
+
+// freshPriceOracle rejects quotes of the wrapped oracle older than maxAge.
+type freshPriceOracle struct {
+	next   PriceOracle
+	maxAge time.Duration
+}
+
+func (o *freshPriceOracle) Quote(ctx context.Context, token string) (*Quote, error) {
+	quote, err := o.next.Quote(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Since(quote.Time) > o.maxAge {
+		return nil, errStalePrice
+	}
+
+	return quote, nil
+}
+
+// medianPriceOracle returns the median of fresh quotes of its sources.
+// Failing sources are skipped as long as at least minSources respond.
+type medianPriceOracle struct {
+	logger     *zap.Logger
+	sources    []PriceOracle
+	minSources int
+}
+
+func (o *medianPriceOracle) Quote(ctx context.Context, token string) (*Quote, error) {
+	var quotes []*Quote
+	missing := true
+	for _, source := range o.sources {
+		quote, err := source.Quote(ctx, token)
+		if err != nil {
+			if err != errNoMarketPrice {
+				missing = false
+				o.logger.Info("server.oracle.medianPriceOracle.Quote: source failure.", zap.Error(err))
+			}
+			continue
+		}
+		quotes = append(quotes, quote)
+	}
+
+	if len(quotes) == 0 && missing {
+		return nil, errNoMarketPrice
+	}
+
+	if len(quotes) < o.minSources {
+		return nil, fmt.Errorf("only %d of %d required price sources responded", len(quotes), o.minSources)
+	}
+
+	sort.Slice(quotes, func(i, j int) bool {
+		return quotes[i].Price.Cmp(quotes[j].Price) < 0
+	})
+
+	median := *quotes[len(quotes)/2]
+	if len(quotes)%2 == 0 {
+		median.Price = quotes[len(quotes)/2-1].Price.Add(quotes[len(quotes)/2].Price).Mul(money.New(5, 1)).RoundUp(priceDecimals)
+	}
+
+	// median is as old as the oldest quote it is built from.
+	for _, quote := range quotes {
+		if quote.Time.Before(median.Time) {
+			median.Time = quote.Time
+		}
+	}
+	median.Source = "median"
+
+	return &median, nil
+}
+
+func newPriceSource(config *PriceSourceConfig, markets marketRegistry, logger *zap.Logger, client *http.Client) (PriceOracle, error) {
+	switch config.Type {
+	case PriceSourceStatic:
+		return staticPriceOracle(config.Prices), nil
+	case PriceSourceFile:
+		if config.Path == "" {
+			return nil, errors.New("file price source requires 'path'")
+		}
+		return &filePriceOracle{path: config.Path}, nil
+	case PriceSourceHTTP:
+		if config.URL == "" {
+			return nil, errors.New("http price source requires 'url'")
+		}
+		return &httpPriceOracle{logger: logger, client: client, url: config.URL}, nil
+	case PriceSourceBisq:
+		scale := config.Scale
+		if scale.IsZero() {
+			scale = money.New(1, 0)
+		}
+		return &bisqPriceOracle{logger: logger, client: client, markets: markets, scale: scale}, nil
+	}
+
+	return nil, errors.New("unknown price source " + config.Type)
+}
+
+// newPriceOracle builds the oracle from config: every source is checked for staleness,
+// sources are aggregated by median and the result is cached.
+func newPriceOracle(config *PriceOracleConfig, markets marketRegistry, logger *zap.Logger, client *http.Client) (PriceOracle, error) {
+	var sources []PriceOracle
+	for i := range config.Sources {
+		source, err := newPriceSource(&config.Sources[i], markets, logger, client)
+		if err != nil {
+			return nil, err
+		}
+
+		if config.MaxAge.Duration != 0 {
+			source = &freshPriceOracle{next: source, maxAge: config.MaxAge.Duration}
+		}
+		sources = append(sources, source)
+	}
+
+	minSources := config.MinSources
+	if minSources == 0 {
+		minSources = 1
+	}
+
+	var oracle PriceOracle = &medianPriceOracle{logger: logger, sources: sources, minSources: minSources}
+
+	if config.CacheTTL.Duration != 0 {
+		oracle = &cachingPriceOracle{
+			next:    oracle,
+			ttl:     config.CacheTTL.Duration,
+			quotes:  make(map[string]*Quote),
+			fetched: make(map[string]time.Time),
+		}
+	}
+
+	return oracle, nil
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"time"
+)
+
+// errSettlementPending tells that the offer was matched while Bisq is unavailable,
+// the match waits in the pending settlement queue.
+var errSettlementPending = errors.New("offers matched, settlement is pending until bisq is available")
+
+func newBreakers(configs map[string]CircuitBreakerConfig) (map[string]*api.Breaker, error) {
+	breakers := make(map[string]*api.Breaker)
+	for upstream, config := range configs {
+		switch upstream {
+		case api.UpstreamBisq, api.UpstreamEthplorer, api.UpstreamFeed:
+		default:
+			return nil, fmt.Errorf("unknown upstream %q", upstream)
+		}
+		if config.FailureThreshold <= 0 {
+			return nil, fmt.Errorf("%s: failure threshold must be positive", upstream)
+		}
+		if config.OpenTimeout.Duration <= 0 {
+			return nil, fmt.Errorf("%s: open timeout must be positive", upstream)
+		}
+
+		breakers[upstream] = api.NewBreaker(api.BreakerConfig{
+			FailureThreshold: config.FailureThreshold,
+			OpenTimeout:      config.OpenTimeout.Duration,
+		})
+	}
+	return breakers, nil
+}
+
+// bisqAvailable is false while the Bisq breaker is open, half-open breaker lets settlement probe the node.
+func (s *Service) bisqAvailable() bool {
+	breaker, ok := s.breakers[api.UpstreamBisq]
+	return !ok || breaker.State() != api.BreakerOpen
+}
+
+// queueSettlement keeps the match until Bisq is available, both offers are out of the book meanwhile.
+func (s *Service) queueSettlement(ctx context.Context, match *Match) {
+	s.mu.Lock()
+	s.pendingSettlements = append(s.pendingSettlements, match)
+	s.mu.Unlock()
+
+	s.log(ctx).Warn(
+		"server.pending.queueSettlement: bisq is unavailable, settlement is pending.",
+		zap.String("buyer", match.BuyOffer.AccountName),
+		zap.String("seller", match.SellOffer.AccountName),
+	)
+}
+
+// isSettlementPending reports whether the account has a match waiting in the queue.
+// Caller must hold s.mu.
+func (s *Service) isSettlementPending(accountName string) bool {
+	for _, match := range s.pendingSettlements {
+		if match.BuyOffer.AccountName == accountName || match.SellOffer.AccountName == accountName {
+			return true
+		}
+	}
+	return false
+}
+
+// settlementDeferred reports whether the settlement failed because Bisq is unavailable, so the match
+// waits in the queue instead of being dropped: the breaker refused the call, also when it is half-open
+// with its probe in flight, or the failed call opened it.
+func (s *Service) settlementDeferred(err error) bool {
+	return errors.Is(err, api.ErrCircuitOpen) || !s.bisqAvailable()
+}
+
+func (s *Service) runPendingSettlements() {
+	ticker := time.NewTicker(s.config.SettlementCheckInterval.Duration)
+	defer ticker.Stop()
+	defer s.jobs.Done()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.settlePending(s.jobContext("pending-settlements"))
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// settlePending settles queued matches in order while Bisq is available.
+// Match whose settlement failed because Bisq went down again keeps its place in the queue
+// and resumes from its published Bisq offer, other failures drop the match, remove the offer
+// and notify both sides.
+func (s *Service) settlePending(ctx context.Context) {
+	for s.bisqAvailable() && !s.isClosing() {
+		s.mu.Lock()
+		if len(s.pendingSettlements) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		match := s.pendingSettlements[0]
+		s.pendingSettlements = s.pendingSettlements[1:]
+		s.mu.Unlock()
+
+		err := s.handleMatchedOffers(ctx, match)
+		if err != nil && s.settlementDeferred(err) {
+			s.mu.Lock()
+			s.pendingSettlements = append([]*Match{match}, s.pendingSettlements...)
+			s.mu.Unlock()
+
+			s.log(ctx).Warn("server.pending.settlePending: bisq is unavailable again.", zap.Error(err))
+			return
+		}
+		if err != nil {
+			s.log(ctx).Error("server.pending.settlePending: server.handleMatchedOffers failure.", zap.Error(err))
+			s.abandonMatch(ctx, match)
+			s.notify(match.BuyOffer.AccountName, "", "settlement of your matched offer failed, please place the offer again.")
+			s.notify(match.SellOffer.AccountName, "", "settlement of your matched offer failed, please place the offer again.")
+			continue
+		}
+
+		s.log(ctx).Info(
+			"server.pending.settlePending: pending settlement started.",
+			zap.String("buyer", match.BuyOffer.AccountName),
+			zap.String("seller", match.SellOffer.AccountName),
+		)
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"bisq-add-on/money"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMatchQueuedWhileBreakerProbes(t *testing.T) {
+	failing := int32(1)
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	bisq := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case atomic.LoadInt32(&failing) == 1:
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.URL.Path == api.VersionURL:
+			close(probing)
+			<-release
+			_, _ = w.Write([]byte(`{"application":"bisq"}`))
+		default:
+			t.Errorf("unexpected bisq call %s %s while the probe is in flight", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer bisq.Close()
+
+	dir, err := ioutil.TempDir("", "pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	openTimeout := 50 * time.Millisecond
+	config := testConfig(bisq.URL, dir)
+	config.CircuitBreakers[api.UpstreamBisq] = CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: Duration{openTimeout}}
+	s, err := InitService(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := s.checkBisq(ctx); err == nil {
+		t.Fatal("failing bisq call succeeded")
+	}
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(2 * openTimeout)
+
+	probed := make(chan error, 1)
+	go func() {
+		probed <- s.checkBisq(ctx)
+	}()
+	<-probing
+	defer func() {
+		close(release)
+		<-probed
+	}()
+
+	if state := s.breakers[api.UpstreamBisq].State(); state != api.BreakerHalfOpen {
+		t.Fatalf("breaker state = %s, want %s", state, api.BreakerHalfOpen)
+	}
+
+	match := testMatch()
+	incoming, resting := match.BuyOffer, match.SellOffer
+	incoming.Direction, incoming.Price = "BUY", money.MustParse("15")
+	resting.Direction, resting.Price = "SELL", money.MustParse("15")
+	s.sellOffers[resting.AccountName] = resting
+
+	matched, err := s.matchOffers(ctx, incoming)
+	if !matched || err != errSettlementPending {
+		t.Fatalf("matched = %v, error = %v, want the match queued", matched, err)
+	}
+
+	s.mu.Lock()
+	pending := len(s.pendingSettlements)
+	s.mu.Unlock()
+	if pending != 1 {
+		t.Fatalf("pending settlements = %d, want 1", pending)
+	}
+}
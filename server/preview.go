@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bisq-add-on/money"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// OfferPreview is what the offer would trade at if it matched now.
+// SecurityDeposit is set for Bisq trades only. Fees lists both the maker and the taker fee,
+// which one applies depends on whether the offer rests in the book or matches right away.
+type OfferPreview struct {
+	Token           string           `json:"token"`
+	Direction       string           `json:"direction"`
+	Settlement      string           `json:"settlement"`
+	Price           money.Amount     `json:"price"`
+	Amount          money.Amount     `json:"amount"`
+	TokenAmount     money.Amount     `json:"tokenAmount"`
+	SecurityDeposit *SecurityDeposit `json:"securityDeposit,omitempty"`
+	Fees            []*TradeFee      `json:"fees"`
+}
+
+// OfferPreviewHandle prices the offer without placing it.
+// Deposit of buy offers follows the tier of the principal, sell offers show the market default
+// since the buyer is not known yet.
+func (s *Service) OfferPreviewHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.preview.OfferPreviewHandle: received new request.")
+
+	principal, ok := s.requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var offer UserOffer
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(&offer)
+	if err != nil {
+		s.log(ctx).Error("server.preview.OfferPreviewHandle: json decoder failure.", zap.Error(err))
+		decoderFailure(w, err, http.StatusInternalServerError, "json decoder failure.")
+		return
+	}
+
+	if offer.AccountName == "" {
+		offer.AccountName = principal
+	}
+	if !s.requireOwner(w, principal, offer.AccountName) {
+		return
+	}
+
+	if offer.Direction != "BUY" && offer.Direction != "SELL" {
+		s.log(ctx).Info("server.preview.OfferPreviewHandle: invalid direction.", zap.String("direction", offer.Direction))
+		handleSimpleResponse(w, http.StatusBadRequest, "'direction' must be BUY or SELL.")
+		return
+	}
+
+	err = normalizeOffer(&offer, s.markets)
+	if err != nil {
+		s.log(ctx).Info("server.preview.OfferPreviewHandle: invalid offer.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	price, err := s.offerPrice(ctx, &offer)
+	if err != nil {
+		s.log(ctx).Info("server.preview.OfferPreviewHandle: server.offerPrice failure.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	market, err := s.markets.market(offer.Token)
+	if err != nil {
+		s.log(ctx).Info("server.preview.OfferPreviewHandle: market lookup failure.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	preview := OfferPreview{
+		Token:       offer.Token,
+		Direction:   offer.Direction,
+		Settlement:  offer.Settlement,
+		Price:       price,
+		Amount:      offer.Amount,
+		TokenAmount: tokenAmount(price, offer.Amount, market.Decimals),
+	}
+
+	if offer.Settlement == SettlementBisq {
+		buyer := ""
+		if offer.Direction == "BUY" {
+			buyer = offer.AccountName
+		}
+
+		preview.SecurityDeposit, err = s.securityDeposit(market, buyer, offer.Amount)
+		if err != nil {
+			s.log(ctx).Info("server.preview.OfferPreviewHandle: server.securityDeposit failure.", zap.Error(err))
+			handleSimpleResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	collection, token, base, decimals := feeTerms(market, offer.Settlement, offer.Amount, preview.TokenAmount)
+	preview.Fees = []*TradeFee{
+		{Liquidity: LiquidityMaker, Collection: collection, Token: token, Amount: market.Fees.Maker.amount(base, decimals)},
+		{Liquidity: LiquidityTaker, Collection: collection, Token: token, Amount: market.Fees.Taker.amount(base, decimals)},
+	}
+
+	handleJSONResponse(w, http.StatusOK, &preview)
+}
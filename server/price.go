@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bisq-add-on/money"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+const (
+	PriceTypeFixed  = "FIXED"
+	PriceTypeMarket = "PERCENTAGE"
+)
+
+// priceDecimals is the precision of prices, Bisq keeps altcoin prices with 8 decimals.
+const priceDecimals = 8
+
+// maxMarketMargin bounds the margin of market-based offers in percent either way,
+// so the price stays positive even with MaxDeviation disabled.
+const maxMarketMargin = 50
+
+var (
+	errNoMarketPrice = errors.New("no market price for token")
+	errStalePrice    = errors.New("market price is stale")
+)
+
+// Quote is the market price of a token at a point in time, in the units of UserOffer.Price.
+type Quote struct {
+	Token  string       `json:"token"`
+	Price  money.Amount `json:"price"`
+	Time   time.Time    `json:"time"`
+	Source string       `json:"source"`
+}
+
+// PriceOracle provides reference market prices of tokens.
+// Implementations return errNoMarketPrice for tokens they know nothing about.
+type PriceOracle interface {
+	Quote(ctx context.Context, token string) (*Quote, error)
+}
+
+// marketPrice applies margin in percent to the reference price, rounded up to priceDecimals.
+// Margin is taken exactly as written, e.g. 1.1 is 1.1% and not the nearest float.
+func marketPrice(reference money.Amount, margin float64) money.Amount {
+	factor := money.MustParse(strconv.FormatFloat(margin, 'f', -1, 64)).Shift(-2).Add(money.New(1, 0))
+	return reference.Mul(factor).RoundUp(priceDecimals)
+}
+
+// offerPrice returns the price the offer trades at right now.
+// Market-based offers are evaluated against the price oracle.
+func (s *Service) offerPrice(ctx context.Context, offer *UserOffer) (money.Amount, error) {
+	if offer.PriceType != PriceTypeMarket {
+		return offer.Price, nil
+	}
+
+	quote, err := s.priceOracle.Quote(ctx, offer.Token)
+	if err != nil {
+		return money.Amount{}, err
+	}
+
+	return marketPrice(quote.Price, offer.MarketMargin), nil
+}
+
+// checkDeviation rejects prices too far from the market.
+// Tokens without market price are not checked.
+func (s *Service) checkDeviation(ctx context.Context, token string, price money.Amount) error {
+	maxDeviation := s.config.PriceOracle.MaxDeviation
+	if maxDeviation == 0 {
+		return nil
+	}
+
+	quote, err := s.priceOracle.Quote(ctx, token)
+	if err == errNoMarketPrice {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	diff := price.Sub(quote.Price).Abs().Shift(2).Rat()
+	deviation, _ := diff.Quo(diff, quote.Price.Rat()).Float64()
+	if deviation > maxDeviation {
+		return fmt.Errorf("price is %.2f%% away from market price %s, at most %.2f%% is allowed", deviation, quote.Price, maxDeviation)
+	}
+
+	return nil
+}
+
+// validateOfferPrice rejects offers that can not be priced or are priced too far from the market.
+func (s *Service) validateOfferPrice(ctx context.Context, offer *UserOffer) error {
+	maxDeviation := s.config.PriceOracle.MaxDeviation
+	if offer.PriceType == PriceTypeMarket && maxDeviation != 0 && math.Abs(offer.MarketMargin) > maxDeviation {
+		return fmt.Errorf("market margin is %.2f%%, at most %.2f%% is allowed", offer.MarketMargin, maxDeviation)
+	}
+
+	price, err := s.offerPrice(ctx, offer)
+	if err != nil {
+		return err
+	}
+
+	return s.checkDeviation(ctx, offer.Token, price)
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bisq-add-on/money"
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// offerCapRetryAfter is the Retry-After hint for offers over the caps,
+// the caps free up only when offers of the account match.
+const offerCapRetryAfter = time.Minute
+
+// bucketPruneInterval is how often buckets that refilled to their burst are dropped.
+const bucketPruneInterval = time.Minute
+
+// RateLimit is a token bucket: Burst requests at once, refilled by Rate requests per second.
+// Zero Rate disables the limit.
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+type RateLimitConfig struct {
+	PerIP      RateLimit `json:"perIP"`
+	PerAccount RateLimit `json:"perAccount"`
+	// MaxOpenOffers caps offers of an account, buy and sell together, resting in the book or matched
+	// and waiting for Bisq. The book keeps one offer per account and side, so with Bisq available
+	// 1 allows a single side at a time and 2 only bounds matches queued while Bisq is down.
+	MaxOpenOffers int `json:"maxOpenOffers"`
+	// MaxBodyBytes caps request bodies.
+	MaxBodyBytes int64 `json:"maxBodyBytes"`
+}
+
+func (c *RateLimitConfig) validate() error {
+	for name, limit := range map[string]RateLimit{"perIP": c.PerIP, "perAccount": c.PerAccount} {
+		if limit.Rate < 0 {
+			return fmt.Errorf("%s: rate can not be negative", name)
+		}
+		if limit.Rate > 0 && limit.Burst <= 0 {
+			return fmt.Errorf("%s: burst must be positive", name)
+		}
+	}
+	if c.MaxOpenOffers <= 0 {
+		return errors.New("max open offers must be positive")
+	}
+	if c.MaxBodyBytes <= 0 {
+		return errors.New("max body bytes must be positive")
+	}
+	return nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter keeps a token bucket per key, e.g. per IP.
+type limiter struct {
+	limit RateLimit
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	pruned  time.Time
+}
+
+func newLimiter(limit RateLimit) *limiter {
+	return &limiter{limit: limit, buckets: make(map[string]*bucket)}
+}
+
+// take spends a token of the key. Returns zero when the request is allowed,
+// otherwise how long until the next token.
+func (l *limiter) take(key string, now time.Time) time.Duration {
+	if l.limit.Rate == 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.pruned) > bucketPruneInterval {
+		l.prune(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(l.limit.Burst), b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.limit.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// prune drops buckets that are full again, a new bucket starts full anyway.
+// Caller must hold l.mu.
+func (l *limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.pruned = now
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// tooManyRequests writes 429 response, Retry-After is rounded up to whole seconds.
+func tooManyRequests(w http.ResponseWriter, retryAfter time.Duration, msg string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	handleSimpleResponse(w, http.StatusTooManyRequests, msg)
+}
+
+// isBodyTooLarge reports whether reading the body failed because MaxBytesReader cut it.
+// The error has no exported type before Go 1.19, so it is told by its message.
+func isBodyTooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "request body too large")
+}
+
+// decoderFailure writes the response for a request body that could not be decoded,
+// 413 when the body was over MaxBodyBytes, otherwise status with msg.
+func decoderFailure(w http.ResponseWriter, err error, status int, msg string) {
+	if isBodyTooLarge(err) {
+		handleSimpleResponse(w, http.StatusRequestEntityTooLarge, "request body too large.")
+		return
+	}
+	handleSimpleResponse(w, status, msg)
+}
+
+// Protect limits requests per client IP and caps the request body.
+// Bodies without Content-Length are cut at MaxBodyBytes, decoders answer them with 413.
+func (s *Service) Protect(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		ip := clientIP(r)
+		if wait := s.ipLimiter.take(ip, time.Now()); wait > 0 {
+			s.log(ctx).Info("server.ratelimit.Protect: ip rate limit exceeded.", zap.String("ip", ip))
+			s.metrics.rateLimited.WithLabelValues("ip").Inc()
+			tooManyRequests(w, wait, "too many requests.")
+			return
+		}
+
+		if r.ContentLength > s.config.RateLimits.MaxBodyBytes {
+			s.log(ctx).Info("server.ratelimit.Protect: request body too large.", zap.Int64("length", r.ContentLength))
+			handleSimpleResponse(w, http.StatusRequestEntityTooLarge, "request body too large.")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, s.config.RateLimits.MaxBodyBytes)
+
+		handler(w, r)
+	}
+}
+
+// limitAccount spends a token of the principal, writes 429 response when there is none.
+func (s *Service) limitAccount(w http.ResponseWriter, r *http.Request, principal string) bool {
+	wait := s.accountLimiter.take(principal, time.Now())
+	if wait == 0 {
+		return true
+	}
+
+	s.log(r.Context()).Info("server.ratelimit.limitAccount: account rate limit exceeded.")
+	s.metrics.rateLimited.WithLabelValues("account").Inc()
+	tooManyRequests(w, wait, "too many requests.")
+	return false
+}
+
+// errOfferCap wraps checkOfferCaps rejections, other checkOfferCaps errors mean the caps could not be checked.
+var errOfferCap = errors.New("offer caps exceeded")
+
+// checkOfferCaps rejects the offer when the account would have more than MaxOpenOffers open offers
+// or more than MaxNotional of the token in them. Offers of matches waiting for Bisq are open too.
+// The offer replaces resting offer of the account in the same direction, "BUY" or "SELL", so that one is not counted.
+func (s *Service) checkOfferCaps(ctx context.Context, offer *UserOffer, direction string) error {
+	market, err := s.markets.market(offer.Token)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	open := []*UserOffer{offer}
+	if resting, ok := s.buyOffers[offer.AccountName]; ok && direction != "BUY" {
+		open = append(open, resting)
+	}
+	if resting, ok := s.sellOffers[offer.AccountName]; ok && direction != "SELL" {
+		open = append(open, resting)
+	}
+	for _, match := range s.pendingSettlements {
+		for _, matched := range []*UserOffer{match.BuyOffer, match.SellOffer} {
+			if matched.AccountName == offer.AccountName {
+				open = append(open, matched)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if len(open) > s.config.RateLimits.MaxOpenOffers {
+		return fmt.Errorf("%w: at most %d open offers are allowed per account", errOfferCap, s.config.RateLimits.MaxOpenOffers)
+	}
+
+	if market.MaxNotional.IsZero() {
+		return nil
+	}
+
+	var notional money.Amount
+	for _, o := range open {
+		if o.Token != offer.Token {
+			continue
+		}
+		price, err := s.offerPrice(ctx, o)
+		if err != nil {
+			return err
+		}
+		notional = notional.Add(tokenAmount(price, o.Amount, market.Decimals))
+	}
+
+	if notional.Cmp(market.MaxNotional) > 0 {
+		return fmt.Errorf("%w: open offers of the account can be worth at most %s %s", errOfferCap, market.MaxNotional, market.Token)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"bisq-add-on/money"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+type failingOracle struct{}
+
+func (failingOracle) Quote(ctx context.Context, token string) (*Quote, error) {
+	return nil, errStalePrice
+}
+
+func TestCheckOfferCaps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ratelimit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestService(t, "http://127.0.0.1:1", dir)
+	s.config.RateLimits.MaxOpenOffers = 2
+	ctx := context.Background()
+
+	match := testMatch()
+	offer, resting := match.BuyOffer, match.SellOffer
+	resting.AccountName = offer.AccountName
+	s.sellOffers[resting.AccountName] = resting
+
+	if err := s.checkOfferCaps(ctx, offer, "BUY"); err != nil {
+		t.Fatalf("offer with one resting offer: error = %v", err)
+	}
+
+	queued := testMatch()
+	queued.BuyOffer.AccountName = offer.AccountName
+	s.queueSettlement(ctx, queued)
+
+	if err := s.checkOfferCaps(ctx, offer, "BUY"); !errors.Is(err, errOfferCap) {
+		t.Fatalf("offer over the cap with a queued match: error = %v, want %v", err, errOfferCap)
+	}
+	if err := s.checkOfferCaps(ctx, resting, "SELL"); err != nil {
+		t.Fatalf("offer replacing the resting one: error = %v", err)
+	}
+
+	s.config.RateLimits.MaxOpenOffers = 10
+	market, err := s.markets.market(offer.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	market.MaxNotional = money.MustParse("1000")
+	resting.PriceType, resting.Price, resting.MarketMargin = PriceTypeMarket, money.Amount{}, 1
+	s.priceOracle = failingOracle{}
+
+	err = s.checkOfferCaps(ctx, offer, "BUY")
+	if err == nil || errors.Is(err, errOfferCap) {
+		t.Fatalf("price oracle failure: error = %v, want an error other than %v", err, errOfferCap)
+	}
+}
+
+func TestProtectRejectsLargeBodies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ratelimit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestService(t, "http://127.0.0.1:1", dir)
+	s.config.RateLimits.MaxBodyBytes = 64
+	handler := s.Protect(s.RegisterHandle)
+
+	body := `{"accountName":"` + strings.Repeat("a", 128) + `"}`
+	for _, chunked := range []bool{false, true} {
+		r := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+		if chunked {
+			r.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("chunked = %v: status = %d, want %d", chunked, w.Code, http.StatusRequestEntityTooLarge)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"context"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// TradeDrift is a local trade state corrected from Bisq.
+type TradeDrift struct {
+	TradeID string     `json:"tradeId"`
+	From    TradeState `json:"from"`
+	To      TradeState `json:"to"`
+}
+
+// ReconcileReport is the outcome of a single reconciliation run.
+type ReconcileReport struct {
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+
+	Drifts []TradeDrift `json:"drifts"`
+	// MissingTrades are local Bisq trades Bisq knows nothing about.
+	MissingTrades []string `json:"missingTrades"`
+	// OrphanedOffers are offers published by the service that no trade took.
+	OrphanedOffers []string `json:"orphanedOffers"`
+	// OrphanedAccounts are payment accounts registered by the service that are no longer in use.
+	OrphanedAccounts []string `json:"orphanedAccounts"`
+
+	Error string `json:"error"`
+}
+
+// bisqTradeState maps Bisq trade to the local state it implies.
+// Second return value is false when Bisq state says nothing beyond the trade being open.
+func bisqTradeState(details *api.TradeDetails) (TradeState, bool) {
+	switch {
+	case details.DisputeState != "" && details.DisputeState != "NO_DISPUTE":
+		return TradeStateDisputed, true
+	case details.PayoutTxID != "",
+		details.State == "WITHDRAW_COMPLETED",
+		strings.Contains(details.State, "PAYOUT_TX"),
+		strings.Contains(details.State, "FIAT_PAYMENT_RECEIPT"):
+		return TradeStateCompleted, true
+	case strings.Contains(details.State, "FIAT_PAYMENT_INITIATED"):
+		return TradeStatePaymentSent, true
+	}
+	return "", false
+}
+
+// driftedState returns the state local trade should move to, if any.
+// Local state only moves forward, terminal states are never changed.
+func driftedState(local TradeState, remote TradeState) (TradeState, bool) {
+	switch local {
+	case TradeStateCompleted, TradeStateCancelled:
+		return "", false
+	case TradeStateDisputed:
+		if remote == TradeStateCompleted {
+			return remote, true
+		}
+		return "", false
+	case TradeStatePaymentSent:
+		if remote == TradeStateCompleted || remote == TradeStateDisputed {
+			return remote, true
+		}
+		return "", false
+	}
+
+	if remote != local {
+		return remote, true
+	}
+	return "", false
+}
+
+// reconcileDispute charges the side that lost the Bisq dispute of the trade once mediation decided it.
+func (s *Service) reconcileDispute(ctx context.Context, trade *Trade) {
+	result, err := api.GetMediationResult(ctx, s.logger, s.client, s.tradeDetails(trade))
+	if err == api.ErrNotFound {
+		return
+	}
+	if err != nil {
+		s.log(ctx).Error("server.reconcile.reconcileDispute: api.GetMediationResult failure.", zap.String("trade", trade.ID), zap.Error(err))
+		return
+	}
+
+	if s.recordDisputeLoss(trade, result.Winner) {
+		s.auditCall(trade.ID, "GetMediationResult", result, nil)
+	}
+}
+
+func (s *Service) runReconciler() {
+	ticker := time.NewTicker(s.config.ReconcileInterval.Duration)
+	defer ticker.Stop()
+	defer s.jobs.Done()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+
+		report := s.reconcile(s.jobContext("reconcile"))
+
+		s.mu.Lock()
+		s.lastReconcile = report
+		s.mu.Unlock()
+	}
+}
+
+// reconcile diffs Bisq state against local trades and fixes drifted states.
+func (s *Service) reconcile(ctx context.Context) *ReconcileReport {
+	s.log(ctx).Info("server.reconcile.reconcile: reconciliation started.")
+
+	report := ReconcileReport{StartedAt: time.Now()}
+	defer func() {
+		report.FinishedAt = time.Now()
+	}()
+
+	remoteTrades, err := api.ListTrades(ctx, s.logger, s.client)
+	if err != nil {
+		s.log(ctx).Error("server.reconcile.reconcile: api.ListTrades failure.", zap.Error(err))
+		report.Error = err.Error()
+		return &report
+	}
+
+	remoteOffers, err := api.ListOffers(ctx, s.logger, s.client)
+	if err != nil {
+		s.log(ctx).Error("server.reconcile.reconcile: api.ListOffers failure.", zap.Error(err))
+		report.Error = err.Error()
+		return &report
+	}
+
+	remoteAccounts, err := api.GetPaymentAccounts(ctx, s.logger, s.client)
+	if err != nil {
+		s.log(ctx).Error("server.reconcile.reconcile: api.GetPaymentAccounts failure.", zap.Error(err))
+		report.Error = err.Error()
+		return &report
+	}
+
+	remote := make(map[string]*api.TradeDetails, len(remoteTrades))
+	for i := range remoteTrades {
+		remote[remoteTrades[i].ID] = &remoteTrades[i]
+	}
+
+	type drift struct {
+		trade *Trade
+		state TradeState
+	}
+	var drifts []drift
+	var disputed, paidOut []*Trade
+
+	s.mu.Lock()
+	takenOffers := make(map[string]bool)
+	for _, trade := range s.trades {
+		if trade.Settlement != SettlementBisq {
+			continue
+		}
+		takenOffers[trade.Details.Offer.ID] = true
+
+		details, ok := remote[trade.ID]
+		if !ok {
+			if trade.State != TradeStateCompleted && trade.State != TradeStateCancelled {
+				report.MissingTrades = append(report.MissingTrades, trade.ID)
+			}
+			continue
+		}
+		trade.Details = details
+		if trade.DisputeOpened && trade.DisputeLoser == "" {
+			disputed = append(disputed, trade)
+		}
+		if trade.State == TradeStateCompleted && details.PayoutTxID != "" && !trade.DepositFeesCollected {
+			paidOut = append(paidOut, trade)
+		}
+
+		remoteState, ok := bisqTradeState(details)
+		if !ok {
+			continue
+		}
+		state, ok := driftedState(trade.State, remoteState)
+		if !ok {
+			continue
+		}
+		if state == TradeStateDisputed {
+			trade.DisputeOpened = true
+		}
+		drifts = append(drifts, drift{trade: trade, state: state})
+		report.Drifts = append(report.Drifts, TradeDrift{TradeID: trade.ID, From: trade.State, To: state})
+	}
+
+	for _, offer := range remoteOffers {
+		if _, ok := s.publishedOffers[offer.ID]; ok && !takenOffers[offer.ID] {
+			report.OrphanedOffers = append(report.OrphanedOffers, offer.ID)
+		}
+	}
+
+	usedAccounts := make(map[string]bool, len(s.accounts))
+	for _, account := range s.accounts {
+		usedAccounts[account.ID] = true
+	}
+	for _, account := range remoteAccounts {
+		if _, ok := s.createdAccounts[account.ID]; ok && !usedAccounts[account.ID] {
+			report.OrphanedAccounts = append(report.OrphanedAccounts, account.ID)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, d := range drifts {
+		s.log(ctx).Warn("server.reconcile.reconcile: trade state drifted from bisq.", zap.String("trade", d.trade.ID))
+		s.setTradeState(d.trade, d.state)
+	}
+
+	for _, trade := range disputed {
+		s.reconcileDispute(ctx, trade)
+	}
+
+	for _, trade := range paidOut {
+		s.collectDepositFees(trade)
+	}
+
+	if len(report.MissingTrades) != 0 || len(report.OrphanedOffers) != 0 || len(report.OrphanedAccounts) != 0 {
+		s.log(ctx).Warn(
+			"server.reconcile.reconcile: bisq state differs from local state.",
+			zap.Strings("missingTrades", report.MissingTrades),
+			zap.Strings("orphanedOffers", report.OrphanedOffers),
+			zap.Strings("orphanedAccounts", report.OrphanedAccounts),
+		)
+	}
+
+	s.log(ctx).Info("server.reconcile.reconcile: reconciliation finished.", zap.Int("drifts", len(report.Drifts)))
+
+	return &report
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"bisq-add-on/money"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// Weights of trade outcomes in the reputation score.
+// Only outcomes the account is at fault for count against it.
+const (
+	reputationCompleted   = 10
+	reputationTimeout     = -30
+	reputationDisputeLost = -10
+)
+
+// Winners of Bisq mediation.
+const (
+	disputeWinnerBuyer  = "BUYER"
+	disputeWinnerSeller = "SELLER"
+)
+
+// AccountStats is the public trade history of an account.
+// Timeouts are trades that expired while the account still owed its transfer.
+// Disputes and Cancellations count trades of the account that ended that way whoever was at fault,
+// DisputesLost counts disputes Bisq mediation decided against the account.
+// Reputation goes negative with faults, so accounts with bad history rank below new ones.
+type AccountStats struct {
+	AccountName           string                  `json:"accountName"`
+	CompletedTrades       int                     `json:"completedTrades"`
+	Volume                map[string]money.Amount `json:"volume"`
+	AverageSettlementTime Duration                `json:"averageSettlementTime"`
+	Disputes              int                     `json:"disputes"`
+	DisputesLost          int                     `json:"disputesLost"`
+	Timeouts              int                     `json:"timeouts"`
+	Cancellations         int                     `json:"cancellations"`
+	Reputation            int                     `json:"reputation"`
+
+	settlementTime time.Duration
+}
+
+// accountStats returns stats of the account, creating empty ones.
+// Caller must hold s.mu.
+func (s *Service) accountStats(accountName string) *AccountStats {
+	stats, ok := s.stats[accountName]
+	if !ok {
+		stats = &AccountStats{AccountName: accountName, Volume: make(map[string]money.Amount)}
+		s.stats[accountName] = stats
+	}
+	return stats
+}
+
+// reputation is the score matching filters offers by, accounts without history have zero.
+// Caller must hold s.mu.
+func (s *Service) reputation(accountName string) int {
+	stats, ok := s.stats[accountName]
+	if !ok {
+		return 0
+	}
+	return stats.Reputation
+}
+
+func (a *AccountStats) updateReputation() {
+	a.Reputation = a.CompletedTrades*reputationCompleted + a.Timeouts*reputationTimeout + a.DisputesLost*reputationDisputeLost
+
+	if a.CompletedTrades != 0 {
+		a.AverageSettlementTime = Duration{a.settlementTime / time.Duration(a.CompletedTrades)}
+	}
+}
+
+// recordTradeOutcome updates stats of both sides when the trade reaches a final or disputed state.
+// Each state counts once per trade.
+func (s *Service) recordTradeOutcome(trade *Trade, state TradeState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// trade moved back to a state it was in before, e.g. an operator disputed it again.
+	if trade.entered(state) > 1 {
+		return
+	}
+
+	for _, role := range []string{TradeRoleBuyer, TradeRoleSeller} {
+		stats := s.accountStats(trade.account(role))
+
+		switch state {
+		case TradeStateCompleted:
+			stats.CompletedTrades++
+			stats.settlementTime += time.Since(trade.CreatedAt)
+			for _, leg := range trade.Legs {
+				stats.Volume[leg.Token] = stats.Volume[leg.Token].Add(leg.Amount)
+			}
+		case TradeStateDisputed:
+			stats.Disputes++
+		case TradeStateCancelled:
+			stats.Cancellations++
+		default:
+			continue
+		}
+
+		stats.updateReputation()
+	}
+}
+
+// recordDisputeLoss charges the side that lost Bisq mediation of the trade, winner is the Bisq winner.
+// Returns false when the winner does not decide the dispute or the loss was recorded before.
+func (s *Service) recordDisputeLoss(trade *Trade, winner string) bool {
+	var loser string
+	switch winner {
+	case disputeWinnerBuyer:
+		loser = TradeRoleSeller
+	case disputeWinnerSeller:
+		loser = TradeRoleBuyer
+	default:
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if trade.DisputeLoser != "" {
+		return false
+	}
+	trade.DisputeLoser = loser
+
+	stats := s.accountStats(trade.account(loser))
+	stats.DisputesLost++
+	stats.updateReputation()
+
+	s.logger.Info(
+		"server.reputation.recordDisputeLoss: dispute lost.",
+		zap.String("account", stats.AccountName),
+		zap.String("trade", trade.ID),
+	)
+	return true
+}
+
+// recordTimeouts charges the sides that had not paid when the trade deadline passed.
+func (s *Service) recordTimeouts(trade *Trade) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for role, leg := range trade.Legs {
+		if leg.Confirmed {
+			continue
+		}
+
+		stats := s.accountStats(trade.account(role))
+		stats.Timeouts++
+		stats.updateReputation()
+
+		s.logger.Info(
+			"server.reputation.recordTimeouts: trade timed out.",
+			zap.String("account", stats.AccountName),
+			zap.String("trade", trade.ID),
+		)
+	}
+}
+
+// meetsReputation reports whether the offers accept each other's reputation.
+// Caller must hold s.mu.
+func (s *Service) meetsReputation(offer *UserOffer, counter *UserOffer) bool {
+	return s.reputation(counter.AccountName) >= offer.MinReputation &&
+		s.reputation(offer.AccountName) >= counter.MinReputation
+}
+
+// AccountStatsHandle returns public stats of the account, it needs no authentication.
+func (s *Service) AccountStatsHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.reputation.AccountStatsHandle: received new request.")
+
+	accountName := r.URL.Query().Get("account")
+	if accountName == "" {
+		s.log(ctx).Info("server.reputation.AccountStatsHandle: 'account' parameter is missing.")
+		handleSimpleResponse(w, http.StatusBadRequest, "'account' parameter is missing.")
+		return
+	}
+
+	s.mu.Lock()
+	_, registered := s.credentials[accountName]
+	var stats AccountStats
+	if registered {
+		stats = *s.accountStats(accountName)
+		volume := make(map[string]money.Amount, len(stats.Volume))
+		for token, amount := range stats.Volume {
+			volume[token] = amount
+		}
+		stats.Volume = volume
+	}
+	s.mu.Unlock()
+
+	if !registered {
+		s.log(ctx).Info("server.reputation.AccountStatsHandle: unknown account.", zap.String("account", accountName))
+		handleSimpleResponse(w, http.StatusNotFound, "unknown account.")
+		return
+	}
+
+	handleJSONResponse(w, http.StatusOK, &stats)
+}
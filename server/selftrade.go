@@ -0,0 +1,86 @@
+package server
+
+import (
+	"bisq-add-on/audit"
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+)
+
+// Self-trade prevention modes, what happens when an offer would match an offer of the same owner.
+const (
+	// SelfTradeCancelNewest rejects the incoming offer, the resting one stays in the book.
+	SelfTradeCancelNewest = "CANCEL_NEWEST"
+	// SelfTradeCancelOldest removes the resting offer, the incoming one goes on matching.
+	SelfTradeCancelOldest = "CANCEL_OLDEST"
+	// SelfTradeCancelBoth removes the resting offer and rejects the incoming one.
+	SelfTradeCancelBoth = "CANCEL_BOTH"
+)
+
+// selfTradeAccount links offers of the same account, see selfTradeLink.
+const selfTradeAccount = "account"
+
+// errSelfTrade is returned by matchOffers when the incoming offer was cancelled by self-trade prevention.
+var errSelfTrade = errors.New("offer would trade with another offer of the same owner")
+
+// PreventedMatch is recorded in the audit log for every self-trade that was prevented.
+type PreventedMatch struct {
+	Mode      string     `json:"mode"`
+	Link      string     `json:"link"`
+	Incoming  *UserOffer `json:"incoming"`
+	Resting   *UserOffer `json:"resting"`
+	Cancelled []string   `json:"cancelled"`
+}
+
+func validateSelfTradePrevention(mode string) error {
+	switch mode {
+	case SelfTradeCancelNewest, SelfTradeCancelOldest, SelfTradeCancelBoth:
+		return nil
+	}
+	return fmt.Errorf("unknown self-trade prevention mode %s", mode)
+}
+
+// selfTradeLink tells what the offers have in common, empty when they belong to different owners.
+// Account is the only link there is: API keys are issued per account, so the principal always
+// is the account, and a verified wallet is bound to a single account, see WalletVerifyHandle.
+// One owner trading under two accounts with separate wallets is not recognised.
+func selfTradeLink(offer *UserOffer, resting *UserOffer) string {
+	if offer.AccountName == resting.AccountName {
+		return selfTradeAccount
+	}
+	return ""
+}
+
+// preventSelfTrade cancels offers as the configured mode says and records the prevented match.
+// Resting offer is removed from book under key, nothing is prevented when it is not there anymore.
+// Returns true when the incoming offer is cancelled.
+func (s *Service) preventSelfTrade(ctx context.Context, offer *UserOffer, resting *UserOffer, book map[string]*UserOffer, key string, link string) bool {
+	mode := s.config.SelfTradePrevention
+
+	cancelResting := mode == SelfTradeCancelOldest || mode == SelfTradeCancelBoth
+	if cancelResting && !s.claimOffer(book, key, resting) {
+		return false
+	}
+
+	prevented := PreventedMatch{Mode: mode, Link: link, Incoming: offer, Resting: resting}
+	if mode == SelfTradeCancelNewest || mode == SelfTradeCancelBoth {
+		prevented.Cancelled = append(prevented.Cancelled, "incoming")
+	}
+	if cancelResting {
+		prevented.Cancelled = append(prevented.Cancelled, "resting")
+		s.notify(resting.AccountName, "", "your resting offer was cancelled, it would have traded with another offer of yours.")
+	}
+
+	s.log(ctx).Info(
+		"server.selftrade.preventSelfTrade: self-trade prevented.",
+		zap.String("mode", mode),
+		zap.String("link", link),
+		zap.String("account", offer.AccountName),
+		zap.String("restingAccount", resting.AccountName),
+	)
+	s.metrics.selfTrades.WithLabelValues(link).Inc()
+	s.audit(audit.SystemPrincipal, AuditSelfTrade, "", &prevented, mode)
+
+	return mode != SelfTradeCancelOldest
+}
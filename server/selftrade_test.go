@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bisq-add-on/money"
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestMatchOffersPreventsSelfTrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selftrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		mode    string
+		err     error
+		resting bool
+	}{
+		{SelfTradeCancelNewest, errSelfTrade, true},
+		{SelfTradeCancelOldest, nil, false},
+		{SelfTradeCancelBoth, errSelfTrade, false},
+	}
+	for _, test := range tests {
+		s, _ := newTestService(t, "http://127.0.0.1:1", dir)
+		s.config.SelfTradePrevention = test.mode
+
+		match := testMatch()
+		incoming, resting := match.BuyOffer, match.SellOffer
+		incoming.AccountName, incoming.Direction, incoming.Price = "alice", "BUY", money.MustParse("15")
+		resting.AccountName, resting.Direction, resting.Price = "alice", "SELL", money.MustParse("15")
+		s.sellOffers[resting.AccountName] = resting
+
+		matched, err := s.matchOffers(context.Background(), incoming)
+		if matched || err != test.err {
+			t.Errorf("%s: matched = %v, error = %v, want no match and %v", test.mode, matched, err, test.err)
+		}
+		if _, ok := s.sellOffers[resting.AccountName]; ok != test.resting {
+			t.Errorf("%s: resting offer in the book = %v, want %v", test.mode, ok, test.resting)
+		}
+	}
+}
+
+func TestClaimOfferOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "selftrade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestService(t, "http://127.0.0.1:1", dir)
+	resting := testMatch().SellOffer
+	s.sellOffers[resting.AccountName] = resting
+
+	var wg sync.WaitGroup
+	claims := make(chan bool, 8)
+	for i := 0; i < cap(claims); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claims <- s.claimOffer(s.sellOffers, resting.AccountName, resting)
+		}()
+	}
+	wg.Wait()
+	close(claims)
+
+	claimed := 0
+	for ok := range claims {
+		if ok {
+			claimed++
+		}
+	}
+	if claimed != 1 {
+		t.Fatalf("claimed %d times, want once", claimed)
+	}
+
+	replacement := testMatch().SellOffer
+	s.sellOffers[resting.AccountName] = replacement
+	s.restoreOffer(s.sellOffers, resting.AccountName, resting)
+	if s.sellOffers[resting.AccountName] != replacement {
+		t.Fatal("restoreOffer replaced the offer placed meanwhile")
+	}
+}
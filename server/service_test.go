@@ -0,0 +1,44 @@
+package server
+
+import (
+	"bisq-add-on/money"
+	"path/filepath"
+	"testing"
+)
+
+// testConfig keeps the audit log inside dir.
+func testConfig(bisqURL string, dir string) *Config {
+	config := DefaultConfig()
+	config.BisqURL = bisqURL
+	config.AuditLogPath = filepath.Join(dir, "audit.log")
+	config.Logging.Level = "error"
+	return config
+}
+
+// newTestService returns the service and its audit log path inside dir.
+func newTestService(t *testing.T, bisqURL string, dir string) (*Service, string) {
+	config := testConfig(bisqURL, dir)
+
+	s, err := InitService(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, config.AuditLogPath
+}
+
+func testMatch() *Match {
+	amount := money.MustParse("0.1")
+	return &Match{
+		BuyOffer:  &UserOffer{AccountName: "buyer", Token: "ETH", Amount: amount, EthereumWallet: "0x00000000000000000000000000000000000000b1"},
+		SellOffer: &UserOffer{AccountName: "seller", Token: "ETH", Amount: amount, EthereumWallet: "0x00000000000000000000000000000000000000a1"},
+		Price:     money.MustParse("15"),
+		Maker:     TradeRoleSeller,
+	}
+}
+
+// testStats copies the stats of the account.
+func testStats(s *Service, accountName string) AccountStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.accountStats(accountName)
+}
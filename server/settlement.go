@@ -0,0 +1,219 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"bisq-add-on/audit"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const tradeIDLength = 16
+
+var transactionIDPattern = regexp.MustCompile("^0x[0-9a-fA-F]{64}$")
+
+var (
+	errInvalidTransactionID = errors.New("transaction id must be 0x followed by 64 hex digits")
+	errTransactionReused    = errors.New("transaction was already used")
+	errNotAwaitingPayment   = errors.New("trade is not awaiting payment")
+	errLegConfirmed         = errors.New("transfer was already confirmed")
+)
+
+// normalizeTransactionID validates the Ethereum transaction hash and lowercases it,
+// so one transaction has one spelling in the replay set, the trade and Ethplorer URLs.
+func normalizeTransactionID(transactionID string) (string, error) {
+	if !transactionIDPattern.MatchString(transactionID) {
+		return "", errInvalidTransactionID
+	}
+	return strings.ToLower(transactionID), nil
+}
+
+func newTradeID() (string, error) {
+	buf := make([]byte, tradeIDLength)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// handleMatchedSwap opens a token swap trade, no Bisq calls are involved.
+func (s *Service) handleMatchedSwap(ctx context.Context, match *Match) error {
+	s.log(ctx).Info("server.settlement.handleMatchedSwap: new incoming offers...")
+
+	id, err := newTradeID()
+	if err != nil {
+		s.log(ctx).Error("server.settlement.handleMatchedSwap: generating trade id failure.", zap.Error(err))
+		return err
+	}
+
+	trade := newSwapTrade(id, match, s.config.SwapTimeout.Duration)
+	addLogFields(ctx, zap.String("tradeId", trade.ID))
+
+	err = s.chargeFees(trade, match)
+	if err != nil {
+		s.log(ctx).Error("server.settlement.handleMatchedSwap: server.chargeFees failure.")
+		return err
+	}
+
+	s.mu.Lock()
+	s.indexTrade(trade)
+	s.mu.Unlock()
+
+	s.auditMatch(trade, match)
+
+	s.log(ctx).Info("server.settlement.handleMatchedSwap: swap trade opened.", zap.String("trade", trade.ID))
+
+	return nil
+}
+
+// hasTransfer reports whether the transaction contains a transfer of the market token matching the leg.
+// Ethplorer reports transfer values in base units of the token.
+func hasTransfer(transactionInfo *api.TransactionInfo, leg *SettlementLeg, market *Market) bool {
+	for _, op := range transactionInfo.Operations {
+		if op.Type != "transfer" || !strings.EqualFold(op.TokenInfo.Address, market.Contract) {
+			continue
+		}
+		if !strings.EqualFold(op.From, leg.FromWallet) || !strings.EqualFold(op.To, leg.ToWallet) {
+			continue
+		}
+		if op.Value.Shift(-market.Decimals).Cmp(leg.Amount) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectTransaction counts the verification failure by reason.
+func (s *Service) rejectTransaction(reason string, err error) (bool, error) {
+	s.metrics.rejections.WithLabelValues(reason).Inc()
+	return false, err
+}
+
+// checkTransaction verifies that transaction settles the leg of the trade.
+// Native coin has to be sent directly to the receiver, ERC20 tokens through the market contract.
+// The transaction has to be mined after the trade was opened and have MinConfirmations.
+// First return value is false when the transaction itself is invalid,
+// true with non-nil error means the transaction could not be fetched.
+func (s *Service) checkTransaction(ctx context.Context, trade *Trade, transactionID string, leg *SettlementLeg) (bool, error) {
+	s.log(ctx).Info("server.settlement.checkTransaction: new incoming transaction...")
+
+	market, err := s.markets.market(leg.Token)
+	if err != nil {
+		return false, err
+	}
+
+	transactionInfo, err := api.GetTxInfo(ctx, s.logger, s.client, transactionID)
+	if err != nil {
+		return true, err
+	}
+
+	if !transactionInfo.Success {
+		return s.rejectTransaction("failed", errors.New("transaction did not complete successfully"))
+	}
+
+	if transactionInfo.Timestamp < trade.CreatedAt.Unix() {
+		return s.rejectTransaction("timestamp", errors.New("transaction was mined before the trade was opened"))
+	}
+
+	if transactionInfo.Confirmations < s.config.MinConfirmations {
+		return s.rejectTransaction("confirmations", fmt.Errorf(
+			"transaction has %d confirmations, at least %d are required, submit it again later",
+			transactionInfo.Confirmations, s.config.MinConfirmations,
+		))
+	}
+
+	if !strings.EqualFold(transactionInfo.From, leg.FromWallet) {
+		return s.rejectTransaction("sender", errors.New("transaction sender address is incorrect"))
+	}
+
+	if market.isNative() {
+		if !strings.EqualFold(transactionInfo.To, leg.ToWallet) {
+			return s.rejectTransaction("receiver", errors.New("transaction receiver address is incorrect"))
+		}
+		if transactionInfo.Value.Cmp(leg.Amount) < 0 {
+			return s.rejectTransaction("amount", fmt.Errorf("transaction value %s is less than %s", transactionInfo.Value, leg.Amount))
+		}
+		return true, nil
+	}
+
+	if !strings.EqualFold(transactionInfo.To, market.Contract) {
+		return s.rejectTransaction("contract", errors.New("transaction is not sent to the token contract"))
+	}
+
+	if !hasTransfer(transactionInfo, leg, market) {
+		return s.rejectTransaction("transfer", fmt.Errorf("transaction has no transfer of at least %s %s to the receiver", leg.Amount, leg.Token))
+	}
+
+	return true, nil
+}
+
+// confirmLeg marks the leg as settled by the transaction and, in the same step under s.mu,
+// claims the next trade state: PARTIALLY_SETTLED while transfers are missing, COMPLETED for a settled swap
+// and PAYMENT_SENT for a settled Bisq trade. Only the call that settles the last leg gets PAYMENT_SENT,
+// so concurrent submissions confirm Bisq payment once. Trade states changed while the transaction
+// was verified, e.g. by the deadline watcher, are kept and the leg is not confirmed.
+// Caller finishes the returned transition with s.transitionEffects.
+func (s *Service) confirmLeg(trade *Trade, leg *SettlementLeg, transactionID string) (*TradeTransition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !trade.isAwaitingPayment() {
+		return nil, errNotAwaitingPayment
+	}
+	if leg.Confirmed {
+		return nil, errLegConfirmed
+	}
+	if _, used := s.transactionIDs[transactionID]; used {
+		return nil, errTransactionReused
+	}
+
+	s.transactionIDs[transactionID] = trade.ID
+	leg.TransactionID = transactionID
+	leg.Confirmed = true
+	leg.ConfirmedAt = time.Now()
+
+	if leg.To == feeCollector {
+		s.ledger.record(LedgerFeeCollected, trade.ID, leg.Token, leg.Amount, LedgerFeeTreasury, receivableAccount(leg.From))
+	} else {
+		s.ledger.record(LedgerTradeLeg, trade.ID, leg.Token, leg.Amount, walletAccount(leg.To), walletAccount(leg.From))
+	}
+
+	state := TradeStatePartiallySettled
+	switch {
+	case !trade.isSettled():
+	case trade.Settlement == SettlementBisq:
+		state = TradeStatePaymentSent
+		trade.confirmingPayment = true
+	default:
+		state = TradeStateCompleted
+	}
+
+	return s.recordTransition(trade, state, audit.SystemPrincipal, ""), nil
+}
+
+// claimPayment reserves Bisq payment confirmation of a trade in PAYMENT_SENT for the caller,
+// returns false when the trade is in another state or another call is confirming it.
+// The caller releases the claim with releasePayment.
+func (s *Service) claimPayment(trade *Trade) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if trade.State != TradeStatePaymentSent || trade.confirmingPayment {
+		return false
+	}
+	trade.confirmingPayment = true
+	return true
+}
+
+func (s *Service) releasePayment(trade *Trade) {
+	s.mu.Lock()
+	trade.confirmingPayment = false
+	s.mu.Unlock()
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNormalizeTransactionID(t *testing.T) {
+	valid := "0x" + strings.Repeat("aB", 32)
+	got, err := normalizeTransactionID(valid)
+	if err != nil || got != strings.ToLower(valid) {
+		t.Fatalf("normalizeTransactionID(%q) = %q, %v, want it lowercased", valid, got, err)
+	}
+
+	for _, id := range []string{"", "0x", valid[2:], valid + "0", valid[:len(valid)-1] + "g", " " + valid} {
+		if _, err := normalizeTransactionID(id); err != errInvalidTransactionID {
+			t.Errorf("normalizeTransactionID(%q) error = %v, want %v", id, err, errInvalidTransactionID)
+		}
+	}
+}
+
+func TestConfirmSwapLegs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "settlement")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestService(t, "http://127.0.0.1:1", dir)
+	trade := testSwapTrade("swap", "alice", "bob")
+	s.mu.Lock()
+	s.indexTrade(trade)
+	s.mu.Unlock()
+
+	buyerTx, sellerTx := "0x"+strings.Repeat("1", 64), "0x"+strings.Repeat("2", 64)
+	buyerLeg, sellerLeg := trade.Legs[TradeRoleBuyer], trade.Legs[TradeRoleSeller]
+
+	confirm := func(leg *SettlementLeg, txID string) (TradeState, error) {
+		transition, err := s.confirmLeg(trade, leg, txID)
+		s.transitionEffects(trade, transition)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return trade.State, err
+	}
+
+	if state, err := confirm(buyerLeg, buyerTx); err != nil || state != TradeStatePartiallySettled {
+		t.Fatalf("first leg: state = %s, error = %v, want %s", state, err, TradeStatePartiallySettled)
+	}
+	if _, err := confirm(buyerLeg, sellerTx); err != errLegConfirmed {
+		t.Fatalf("confirmed leg again: error = %v, want %v", err, errLegConfirmed)
+	}
+	if _, err := confirm(sellerLeg, buyerTx); err != errTransactionReused {
+		t.Fatalf("second leg with the first transaction: error = %v, want %v", err, errTransactionReused)
+	}
+	if sellerLeg.Confirmed {
+		t.Fatal("second leg confirmed by a reused transaction")
+	}
+	if state, err := confirm(sellerLeg, sellerTx); err != nil || state != TradeStateCompleted {
+		t.Fatalf("second leg: state = %s, error = %v, want %s", state, err, TradeStateCompleted)
+	}
+
+	stats := testStats(s, "alice")
+	if stats.CompletedTrades != 1 {
+		t.Fatalf("completed trades = %d, want 1", stats.CompletedTrades)
+	}
+}
+
+func TestSwapTimeoutDisputesAndChargesUnpaidSide(t *testing.T) {
+	dir, err := ioutil.TempDir("", "settlement")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestService(t, "http://127.0.0.1:1", dir)
+	trade := testSwapTrade("swap", "alice", "bob")
+	s.mu.Lock()
+	s.indexTrade(trade)
+	s.mu.Unlock()
+
+	transition, err := s.confirmLeg(trade, trade.Legs[TradeRoleBuyer], "0x"+strings.Repeat("1", 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.transitionEffects(trade, transition)
+
+	s.checkDeadlines(s.jobContext("test"), trade.Deadline.Add(time.Second))
+
+	s.mu.Lock()
+	state := trade.State
+	s.mu.Unlock()
+	if state != TradeStateDisputed {
+		t.Fatalf("state = %s, want %s", state, TradeStateDisputed)
+	}
+	if timeouts := testStats(s, "alice").Timeouts; timeouts != 0 {
+		t.Fatalf("buyer that paid timeouts = %d, want 0", timeouts)
+	}
+	if timeouts := testStats(s, "bob").Timeouts; timeouts != 1 {
+		t.Fatalf("seller that did not pay timeouts = %d, want 1", timeouts)
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"bisq-add-on/audit"
+	"context"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"time"
+)
+
+// AuditSettlementCheckpoint records a settlement that was still running when shutdown deadline passed.
+const AuditSettlementCheckpoint = "settlement.checkpoint"
+
+const drainPollInterval = 100 * time.Millisecond
+
+// settlement is a running sequence of Bisq calls, kept so shutdown can wait for it.
+type settlement struct {
+	name    string
+	tradeID string
+	payload interface{}
+	started time.Time
+}
+
+// startSettlement registers the settlement until the returned func is called.
+func (s *Service) startSettlement(name string, tradeID string, payload interface{}) func() {
+	s.mu.Lock()
+	s.nextSettlement++
+	id := s.nextSettlement
+	s.settlements[id] = &settlement{name: name, tradeID: tradeID, payload: payload, started: time.Now()}
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		delete(s.settlements, id)
+		s.mu.Unlock()
+	}
+}
+
+// StopAccepting makes the service refuse new offers, running trades go on.
+func (s *Service) StopAccepting() {
+	s.mu.Lock()
+	s.closing = true
+	s.mu.Unlock()
+}
+
+func (s *Service) isClosing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
+
+// Shutdown stops accepting offers and background jobs, then waits for running settlements until ctx is done.
+// Settlements still running at that point and matches waiting for Bisq are checkpointed to the audit log,
+// so operators can finish them.
+// The audit log is closed and logs are flushed last.
+func (s *Service) Shutdown(ctx context.Context) error {
+	s.StopAccepting()
+	s.logger.Info("server.shutdown.Shutdown: shutting down.")
+
+	close(s.done)
+	jobsDone := make(chan struct{})
+	go func() {
+		s.jobs.Wait()
+		close(jobsDone)
+	}()
+
+	select {
+	case <-jobsDone:
+	case <-ctx.Done():
+		s.logger.Warn("server.shutdown.Shutdown: background jobs did not stop in time.")
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+drain:
+	for {
+		s.mu.Lock()
+		running := len(s.settlements)
+		s.mu.Unlock()
+
+		if running == 0 {
+			s.logger.Info("server.shutdown.Shutdown: settlements drained.")
+			break
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			break drain
+		}
+	}
+
+	s.checkpointSettlements()
+
+	var err error
+	if s.auditLog != nil {
+		err = s.auditLog.Close()
+		if err != nil {
+			s.logger.Error("server.shutdown.Shutdown: audit log close failure.", zap.Error(err))
+		}
+	}
+
+	_ = s.logger.Sync()
+
+	return err
+}
+
+// ShutdownOnSignal blocks until a signal arrives on stop, main registers it for SIGINT and SIGTERM.
+// New offers are refused first, then requests in flight of httpServer and running settlements
+// share the ShutdownTimeout deadline.
+func (s *Service) ShutdownOnSignal(stop <-chan os.Signal, httpServer *http.Server) error {
+	sig := <-stop
+	s.logger.Info("server.shutdown.ShutdownOnSignal: received signal.", zap.String("signal", sig.String()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout.Duration)
+	defer cancel()
+
+	s.StopAccepting()
+
+	err := httpServer.Shutdown(ctx)
+	if err != nil {
+		s.logger.Error("server.shutdown.ShutdownOnSignal: http server shutdown failure.", zap.Error(err))
+	}
+
+	return s.Shutdown(ctx)
+}
+
+func (s *Service) checkpointSettlements() {
+	s.mu.Lock()
+	running := make([]*settlement, 0, len(s.settlements))
+	for _, settlement := range s.settlements {
+		running = append(running, settlement)
+	}
+	pending := s.pendingSettlements
+	s.mu.Unlock()
+
+	for _, settlement := range running {
+		s.logger.Warn(
+			"server.shutdown.checkpointSettlements: settlement interrupted.",
+			zap.String("settlement", settlement.name),
+			zap.String("trade", settlement.tradeID),
+			zap.Duration("running", time.Since(settlement.started)),
+		)
+		s.audit(audit.SystemPrincipal, AuditSettlementCheckpoint, settlement.tradeID, settlement.payload, "INTERRUPTED: "+settlement.name)
+	}
+
+	for _, match := range pending {
+		s.logger.Warn(
+			"server.shutdown.checkpointSettlements: pending settlement dropped.",
+			zap.String("buyer", match.BuyOffer.AccountName),
+			zap.String("seller", match.SellOffer.AccountName),
+		)
+		s.audit(audit.SystemPrincipal, AuditSettlementCheckpoint, "", match, "PENDING")
+	}
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"bisq-add-on/audit"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// bisqStub answers the Bisq calls of handleMatchedOffers, PublishOffer blocks until release is closed.
+type bisqStub struct {
+	published chan struct{}
+	release   chan struct{}
+}
+
+func newBisqStub() *bisqStub {
+	return &bisqStub{published: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (b *bisqStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var resp interface{}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == api.PaymentAccountsURL:
+		resp = api.PaymentAccountList{}
+	case r.Method == http.MethodPost && r.URL.Path == api.PaymentAccountsURL:
+		resp = api.PaymentAccount{ID: "account-1"}
+	case r.Method == http.MethodPost && r.URL.Path == api.OfferURL:
+		close(b.published)
+		<-b.release
+		resp = api.OfferDetail{ID: "offer-1"}
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/take"):
+		resp = api.TradeDetails{ID: "trade-1"}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// startBlockedSettlement runs handleMatchedOffers and waits until it blocks in PublishOffer.
+func startBlockedSettlement(t *testing.T, s *Service, stub *bisqStub) chan error {
+	settled := make(chan error, 1)
+	go func() {
+		settled <- s.handleMatchedOffers(context.Background(), testMatch())
+	}()
+
+	select {
+	case <-stub.published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("settlement did not reach bisq")
+	}
+	return settled
+}
+
+func checkpoints(t *testing.T, path string) []audit.Entry {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var entries []audit.Entry
+	err = audit.Verify(file, func(entry *audit.Entry) error {
+		if entry.Operation == AuditSettlementCheckpoint {
+			entries = append(entries, *entry)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+// startShutdown sends SIGTERM to the test process and runs the shutdown main does on it.
+func startShutdown(t *testing.T, s *Service) chan error {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM)
+
+	done := make(chan error, 1)
+	go func() {
+		defer signal.Stop(stop)
+		done <- s.ShutdownOnSignal(stop, &http.Server{})
+	}()
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = process.Signal(syscall.SIGTERM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return done
+}
+
+func waitClosing(t *testing.T, s *Service) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.isClosing() {
+		if time.Now().After(deadline) {
+			t.Fatal("service did not stop accepting offers")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSIGTERMDrainsRunningSettlement(t *testing.T) {
+	stub := newBisqStub()
+	bisq := httptest.NewServer(stub)
+	defer bisq.Close()
+
+	dir, err := ioutil.TempDir("", "shutdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, auditPath := newTestService(t, bisq.URL, dir)
+	settled := startBlockedSettlement(t, s, stub)
+
+	s.config.ShutdownTimeout = Duration{10 * time.Second}
+	done := startShutdown(t, s)
+	waitClosing(t, s)
+
+	w := httptest.NewRecorder()
+	s.BuyHandle(w, httptest.NewRequest(http.MethodPost, "/buy", strings.NewReader("{}")))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("new offer during shutdown: status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+
+	select {
+	case err := <-done:
+		t.Fatalf("shutdown returned before the settlement drained: %v", err)
+	case <-time.After(3 * drainPollInterval):
+	}
+
+	close(stub.release)
+
+	if err := <-settled; err != nil {
+		t.Fatalf("settlement failed: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+
+	s.mu.Lock()
+	trades := len(s.trades)
+	s.mu.Unlock()
+	if trades != 1 {
+		t.Fatalf("trades = %d, want the drained settlement to open 1", trades)
+	}
+	if entries := checkpoints(t, auditPath); len(entries) != 0 {
+		t.Fatalf("checkpoints = %d, want none for a drained settlement", len(entries))
+	}
+}
+
+func TestShutdownCheckpointsUnfinishedSettlements(t *testing.T) {
+	stub := newBisqStub()
+	bisq := httptest.NewServer(stub)
+	defer bisq.Close()
+
+	dir, err := ioutil.TempDir("", "shutdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, auditPath := newTestService(t, bisq.URL, dir)
+	settled := startBlockedSettlement(t, s, stub)
+	// the interrupted settlement goes on after shutdown, it must not outlive the test.
+	defer func() {
+		close(stub.release)
+		<-settled
+	}()
+
+	pending := testMatch()
+	pending.BuyOffer.AccountName, pending.SellOffer.AccountName = "queued-buyer", "queued-seller"
+	s.queueSettlement(context.Background(), pending)
+
+	s.config.ShutdownTimeout = Duration{300 * time.Millisecond}
+	if err := <-startShutdown(t, s); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+
+	states := make(map[string]bool)
+	for _, entry := range checkpoints(t, auditPath) {
+		states[entry.State] = true
+	}
+	for _, state := range []string{"INTERRUPTED: handleMatchedOffers", "PENDING"} {
+		if !states[state] {
+			t.Errorf("no %q checkpoint in the audit log, got %v", state, states)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"go.uber.org/zap"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+type TLSConfig struct {
+	// CertFile and KeyFile enable HTTPS, both files are reloaded when they change.
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// ReloadInterval is how often the files are checked for changes.
+	ReloadInterval Duration `json:"reloadInterval"`
+
+	// ClientCAFile enables mutual TLS: client certificates signed by the CA are verified
+	// and authenticate the account ClientAccounts maps their subject common name to.
+	// Clients without a certificate still authenticate by API key.
+	ClientCAFile   string            `json:"clientCAFile"`
+	ClientAccounts map[string]string `json:"clientAccounts"`
+}
+
+// BisqTLSConfig is api.TLSOptions as it is read from config.
+type BisqTLSConfig struct {
+	CAFile   string `json:"caFile"`
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+// certReloader serves the certificate from files, replacing it when the files change.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	r := certReloader{certFile: certFile, keyFile: keyFile}
+	_, err := r.reload()
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// modified returns the latest modification time of the files.
+func (r *certReloader) modified() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// reload loads the certificate if the files changed since the last load, reports whether it did.
+// Broken files keep the current certificate.
+func (r *certReloader) reload() (bool, error) {
+	modTime, err := r.modified()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	changed := !modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	r.cert, r.modTime = &cert, modTime
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (s *Service) watchCertificates() {
+	ticker := time.NewTicker(s.config.TLS.ReloadInterval.Duration)
+	defer ticker.Stop()
+	defer s.jobs.Done()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+
+		reloaded, err := s.certs.reload()
+		if err != nil {
+			s.logger.Error("server.tls.watchCertificates: certificate reload failure.", zap.Error(err))
+			continue
+		}
+		if reloaded {
+			s.logger.Info("server.tls.watchCertificates: certificate reloaded.")
+		}
+	}
+}
+
+// TLSConfig returns config the HTTP server should serve with, nil when TLS is not configured.
+func (s *Service) TLSConfig() (*tls.Config, error) {
+	if s.certs == nil {
+		return nil, nil
+	}
+
+	config := tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: s.certs.GetCertificate,
+	}
+
+	if s.config.TLS.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(s.config.TLS.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + s.config.TLS.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return &config, nil
+}
+
+// certificateAccount returns the account the verified client certificate of the request is mapped to.
+func (s *Service) certificateAccount(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	accountName, ok := s.config.TLS.ClientAccounts[r.TLS.VerifiedChains[0][0].Subject.CommonName]
+	return accountName, ok
+}
@@ -0,0 +1,474 @@
+package server
+
+import (
+	"bisq-add-on/api"
+	"bisq-add-on/audit"
+	"bisq-add-on/money"
+	"errors"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+type TradeState string
+
+const (
+	TradeStatePending          TradeState = "PENDING"
+	TradeStatePartiallySettled TradeState = "PARTIALLY_SETTLED"
+	TradeStatePaymentSent      TradeState = "PAYMENT_SENT"
+	TradeStateCompleted        TradeState = "COMPLETED"
+	TradeStateDisputed         TradeState = "DISPUTED"
+	TradeStateCancelled        TradeState = "CANCELLED"
+)
+
+var (
+	errNoTrade        = errors.New("no matched trade")
+	errAmbiguousTrade = errors.New("account has trades on both sides, 'trade' parameter is required")
+)
+
+const (
+	TradeRoleBuyer  = "BUYER"
+	TradeRoleSeller = "SELLER"
+)
+
+const (
+	// SettlementBisq trades tokens for BTC locked in Bisq escrow.
+	SettlementBisq = "BISQ"
+	// SettlementTokenSwap trades tokens for tokens, both legs are ERC20 transfers.
+	SettlementTokenSwap = "TOKEN_SWAP"
+)
+
+// SettlementLeg is a single transfer one side of the trade owes to the other.
+type SettlementLeg struct {
+	From          string       `json:"from"`
+	To            string       `json:"to"`
+	FromWallet    string       `json:"fromWallet"`
+	ToWallet      string       `json:"toWallet"`
+	Token         string       `json:"token"`
+	Amount        money.Amount `json:"amount"`
+	TransactionID string       `json:"transactionId"`
+	Confirmed     bool         `json:"confirmed"`
+	ConfirmedAt   time.Time    `json:"confirmedAt"`
+}
+
+// Match is a pair of crossing offers and the price they trade at.
+// Price is taken from the resting offer, evaluated at match time for PriceTypeMarket offers.
+// TokenAmount is what the buyer owes at that price, see tokenAmount.
+// Maker is the role of the resting offer.
+// BisqOfferID is the Bisq offer published for the match, settlement resumes by taking it.
+type Match struct {
+	BuyOffer    *UserOffer
+	SellOffer   *UserOffer
+	Price       money.Amount
+	TokenAmount money.Amount
+	Maker       string
+	BisqOfferID string
+}
+
+// Trade is a pair of matched offers.
+// Buyer always transfers tokens to the seller. Seller either locks BTC in
+// Bisq escrow or, for token swaps, transfers the counter token to the buyer.
+type Trade struct {
+	ID         string
+	Settlement string
+	BuyOffer   *UserOffer
+	SellOffer  *UserOffer
+	Price      money.Amount
+	State      TradeState
+	CreatedAt  time.Time
+	Deadline   time.Time
+	// Warned is set once both sides were notified about the approaching deadline.
+	Warned bool
+	// DisputeOpened is set once the dispute was opened in Bisq.
+	DisputeOpened bool
+	// DisputeLoser is the role Bisq mediation decided against, empty until it did.
+	DisputeLoser string
+	// DepositFeesCollected is set once fees kept from the Bisq deposit were booked, see collectDepositFees.
+	DepositFeesCollected bool
+
+	// Legs are keyed by the role of the sending side.
+	Legs map[string]*SettlementLeg
+	// Fees are keyed by the role that owes them.
+	Fees map[string]*TradeFee
+
+	// Details is the last Bisq view of the trade, the reconciler replaces it under s.mu, see tradeDetails.
+	Details *api.TradeDetails
+
+	// History lists every state the trade went through, oldest first.
+	History []*TradeTransition
+
+	// confirmingPayment is set while Bisq payment of the trade is being confirmed.
+	confirmingPayment bool
+}
+
+// TradeTransition is an entry of the trade state history.
+// Reason is set for transitions forced by operators.
+type TradeTransition struct {
+	From      TradeState `json:"from"`
+	To        TradeState `json:"to"`
+	At        time.Time  `json:"at"`
+	Principal string     `json:"principal"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+func openedTransition(at time.Time) []*TradeTransition {
+	return []*TradeTransition{{To: TradeStatePending, At: at, Principal: audit.SystemPrincipal}}
+}
+
+// TradeStatus is a view of the trade from one of its sides.
+// Token and amount are what the side has to send, or has to receive when it owes nothing.
+type TradeStatus struct {
+	TradeID            string                    `json:"tradeId"`
+	Settlement         string                    `json:"settlement"`
+	Role               string                    `json:"role"`
+	State              TradeState                `json:"state"`
+	CounterpartyWallet string                    `json:"counterpartyWallet"`
+	Token              string                    `json:"token"`
+	TokenContract      string                    `json:"tokenContract"`
+	Amount             money.Amount              `json:"amount"`
+	Deadline           time.Time                 `json:"deadline"`
+	Legs               map[string]*SettlementLeg `json:"legs"`
+	Fees               map[string]*TradeFee      `json:"fees"`
+}
+
+func newLeg(from *UserOffer, to *UserOffer, token string, amount money.Amount) *SettlementLeg {
+	return &SettlementLeg{
+		From:       from.AccountName,
+		To:         to.AccountName,
+		FromWallet: from.EthereumWallet,
+		ToWallet:   to.EthereumWallet,
+		Token:      token,
+		Amount:     amount,
+	}
+}
+
+func newTrade(match *Match, details *api.TradeDetails) *Trade {
+	now := time.Now()
+	trade := Trade{
+		ID:         details.ID,
+		Settlement: SettlementBisq,
+		BuyOffer:   match.BuyOffer,
+		SellOffer:  match.SellOffer,
+		Price:      match.Price,
+		State:      TradeStatePending,
+		CreatedAt:  now,
+		Legs: map[string]*SettlementLeg{
+			TradeRoleBuyer: newLeg(match.BuyOffer, match.SellOffer, match.BuyOffer.Token, match.TokenAmount),
+		},
+		Details: details,
+		History: openedTransition(now),
+	}
+
+	// bisq reports both values in milliseconds.
+	if details.TakeOfferDate != 0 && details.Offer.MaxTradePeriod != 0 {
+		trade.Deadline = time.Unix(0, (details.TakeOfferDate+details.Offer.MaxTradePeriod)*int64(time.Millisecond))
+	}
+
+	return &trade
+}
+
+// tradeDetails returns Bisq details of the trade for calls made without s.mu.
+// Details are replaced and never modified, so the returned value stays consistent.
+func (s *Service) tradeDetails(trade *Trade) *api.TradeDetails {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return trade.Details
+}
+
+func newSwapTrade(id string, match *Match, timeout time.Duration) *Trade {
+	now := time.Now()
+	return &Trade{
+		ID:         id,
+		Settlement: SettlementTokenSwap,
+		BuyOffer:   match.BuyOffer,
+		SellOffer:  match.SellOffer,
+		Price:      match.Price,
+		State:      TradeStatePending,
+		CreatedAt:  now,
+		Deadline:   now.Add(timeout),
+		Legs: map[string]*SettlementLeg{
+			TradeRoleBuyer:  newLeg(match.BuyOffer, match.SellOffer, match.BuyOffer.Token, match.TokenAmount),
+			TradeRoleSeller: newLeg(match.SellOffer, match.BuyOffer, match.SellOffer.CounterToken, match.SellOffer.Amount),
+		},
+		History: openedTransition(now),
+	}
+}
+
+// isSettled reports whether every leg of the trade, fee legs included, is confirmed.
+func (t *Trade) isSettled() bool {
+	for _, leg := range t.Legs {
+		if !leg.Confirmed {
+			return false
+		}
+	}
+	for _, fee := range t.Fees {
+		if fee.Leg != nil && !fee.Leg.Confirmed {
+			return false
+		}
+	}
+	return true
+}
+
+// account returns the account name of the role.
+func (t *Trade) account(role string) string {
+	if role == TradeRoleSeller {
+		return t.SellOffer.AccountName
+	}
+	return t.BuyOffer.AccountName
+}
+
+// tokenAmount is the amount of tokens the buyer transfers to the seller.
+// It is rounded up to what the token can represent, so the seller never gets less than the price.
+func tokenAmount(price money.Amount, amount money.Amount, decimals int) money.Amount {
+	return price.Mul(amount).RoundUp(decimals)
+}
+
+// findTrade returns the trade of the account and the role the account plays in it.
+// Trade with tradeID is looked up among every trade of the account, finished ones included.
+// Without tradeID the account must have an active trade on one side only.
+// Caller must hold s.mu.
+func (s *Service) findTrade(accountName string, tradeID string) (*Trade, string, error) {
+	if tradeID != "" {
+		trade, ok := s.trades[tradeID]
+		switch {
+		case !ok:
+		case trade.BuyOffer.AccountName == accountName:
+			return trade, TradeRoleBuyer, nil
+		case trade.SellOffer.AccountName == accountName:
+			return trade, TradeRoleSeller, nil
+		}
+		return nil, "", errNoTrade
+	}
+
+	buyTrade, buying := s.buyTrades[accountName]
+	sellTrade, selling := s.sellTrades[accountName]
+	switch {
+	case buying && selling:
+		return nil, "", errAmbiguousTrade
+	case buying:
+		return buyTrade, TradeRoleBuyer, nil
+	case selling:
+		return sellTrade, TradeRoleSeller, nil
+	}
+	return nil, "", errNoTrade
+}
+
+// handleTradeLookupFailure responds to a findTrade failure.
+func handleTradeLookupFailure(w http.ResponseWriter, err error) {
+	if err == errAmbiguousTrade {
+		handleSimpleResponse(w, http.StatusConflict, err.Error()+".")
+		return
+	}
+	handleSimpleResponse(w, http.StatusNotFound, "no matched trade.")
+}
+
+// indexTrade adds the opened trade to the trades and to the active trades of both sides.
+// Caller must hold s.mu.
+func (s *Service) indexTrade(trade *Trade) {
+	s.trades[trade.ID] = trade
+	s.buyTrades[trade.BuyOffer.AccountName] = trade
+	s.sellTrades[trade.SellOffer.AccountName] = trade
+}
+
+// unindexTrade removes the finished trade from the active trades of both sides.
+// Caller must hold s.mu.
+func (s *Service) unindexTrade(trade *Trade) {
+	if s.buyTrades[trade.BuyOffer.AccountName] == trade {
+		delete(s.buyTrades, trade.BuyOffer.AccountName)
+	}
+	if s.sellTrades[trade.SellOffer.AccountName] == trade {
+		delete(s.sellTrades, trade.SellOffer.AccountName)
+	}
+}
+
+func (s *Service) setTradeState(trade *Trade, state TradeState) {
+	s.transitionTrade(trade, state, audit.SystemPrincipal, "")
+}
+
+// transitionTrade moves the trade to the state on behalf of the principal and records it in the history.
+func (s *Service) transitionTrade(trade *Trade, state TradeState, principal string, reason string) {
+	s.mu.Lock()
+	transition := s.recordTransition(trade, state, principal, reason)
+	s.mu.Unlock()
+
+	s.transitionEffects(trade, transition)
+}
+
+// transitionTradeFrom is transitionTrade that only happens while the trade is in the state from,
+// it reports whether the trade moved.
+func (s *Service) transitionTradeFrom(trade *Trade, from TradeState, state TradeState, principal string, reason string) bool {
+	s.mu.Lock()
+	if trade.State != from {
+		s.mu.Unlock()
+		return false
+	}
+	transition := s.recordTransition(trade, state, principal, reason)
+	s.mu.Unlock()
+
+	s.transitionEffects(trade, transition)
+	return transition != nil
+}
+
+// isFinished reports whether the trade is in a terminal state. Fees and reputation were settled
+// on entering it, so the trade never leaves it.
+func (t *Trade) isFinished() bool {
+	return t.State == TradeStateCompleted || t.State == TradeStateCancelled
+}
+
+// entered counts how many times the trade moved to the state.
+func (t *Trade) entered(state TradeState) int {
+	count := 0
+	for _, transition := range t.History {
+		if transition.To == state {
+			count++
+		}
+	}
+	return count
+}
+
+// recordTransition moves the trade to the state and appends the transition to its history,
+// returns nil when the trade already is in the state or is finished. Caller must hold s.mu.
+func (s *Service) recordTransition(trade *Trade, state TradeState, principal string, reason string) *TradeTransition {
+	if trade.State == state || trade.isFinished() {
+		return nil
+	}
+
+	transition := TradeTransition{
+		From:      trade.State,
+		To:        state,
+		At:        time.Now(),
+		Principal: principal,
+		Reason:    reason,
+	}
+	trade.State = state
+	trade.History = append(trade.History, &transition)
+	if trade.isFinished() {
+		s.unindexTrade(trade)
+	}
+	return &transition
+}
+
+// transitionEffects audits the transition and updates fees, reputation and metrics. Nil transition does nothing.
+func (s *Service) transitionEffects(trade *Trade, transition *TradeTransition) {
+	if transition == nil {
+		return
+	}
+
+	var payload interface{}
+	if transition.Reason != "" {
+		payload = transition.Reason
+	}
+	s.audit(transition.Principal, AuditTradeState, trade.ID, payload, string(transition.To))
+	s.recordTradeOutcome(trade, transition.To)
+
+	switch transition.To {
+	case TradeStateCompleted:
+		s.collectDepositFees(trade)
+		s.metrics.timeToSettle.WithLabelValues(trade.Settlement).Observe(time.Since(trade.CreatedAt).Seconds())
+	case TradeStateCancelled:
+		s.refundFees(trade)
+	}
+
+	s.logger.Info(
+		"server.trade.transitionTrade: trade state changed.",
+		zap.String("trade", trade.ID),
+		zap.String("from", string(transition.From)),
+		zap.String("to", string(transition.To)),
+		zap.String("principal", transition.Principal),
+		zap.String("reason", transition.Reason),
+	)
+}
+
+func tradeStatus(trade *Trade, role string, markets marketRegistry) *TradeStatus {
+	counterparty := trade.SellOffer
+	counterRole := TradeRoleSeller
+	if role == TradeRoleSeller {
+		counterparty = trade.BuyOffer
+		counterRole = TradeRoleBuyer
+	}
+
+	leg, ok := trade.Legs[role]
+	if !ok {
+		leg = trade.Legs[counterRole]
+	}
+
+	var contract string
+	if market, ok := markets[leg.Token]; ok {
+		contract = market.Contract
+	}
+
+	legs := make(map[string]*SettlementLeg, len(trade.Legs))
+	for r, l := range trade.Legs {
+		copied := *l
+		legs[r] = &copied
+	}
+
+	fees := make(map[string]*TradeFee, len(trade.Fees))
+	for r, f := range trade.Fees {
+		copied := *f
+		if f.Leg != nil {
+			leg := *f.Leg
+			copied.Leg = &leg
+		}
+		fees[r] = &copied
+	}
+
+	return &TradeStatus{
+		TradeID:            trade.ID,
+		Settlement:         trade.Settlement,
+		Role:               role,
+		State:              trade.State,
+		CounterpartyWallet: counterparty.EthereumWallet,
+		Token:              leg.Token,
+		TokenContract:      contract,
+		Amount:             leg.Amount,
+		Deadline:           trade.Deadline,
+		Legs:               legs,
+		Fees:               fees,
+	}
+}
+
+// CheckOfferHandle reports the trade the account is part of, "trade" picks one by ID.
+// Buyer gets the wallet to send tokens to, seller gets the wallet tokens are expected from.
+// Finished trades are only reported by ID.
+func (s *Service) CheckOfferHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.trade.CheckOfferHandle: received new request.")
+
+	principal, ok := s.requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	accountName := principal
+	if accountNames, ok := r.URL.Query()["account"]; ok && len(accountNames) != 0 {
+		accountName = accountNames[0]
+	}
+	if !s.requireOwner(w, principal, accountName) {
+		return
+	}
+
+	tradeID := r.URL.Query().Get("trade")
+
+	s.mu.Lock()
+	trade, role, err := s.findTrade(accountName, tradeID)
+	var status *TradeStatus
+	if err == nil {
+		status = tradeStatus(trade, role, s.markets)
+	}
+	pending := err == errNoTrade && tradeID == "" && s.isSettlementPending(accountName)
+	s.mu.Unlock()
+
+	if pending {
+		handleSimpleResponse(w, http.StatusAccepted, "offer matched, settlement is pending until bisq is available.")
+		return
+	}
+
+	if err != nil {
+		s.log(ctx).Info("server.trade.CheckOfferHandle: no matched trade.", zap.String("account", accountName), zap.Error(err))
+		handleTradeLookupFailure(w, err)
+		return
+	}
+
+	handleJSONResponse(w, http.StatusOK, status)
+}
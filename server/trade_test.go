@@ -0,0 +1,66 @@
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func testSwapTrade(id string, buyer string, seller string) *Trade {
+	match := testMatch()
+	match.BuyOffer.AccountName, match.SellOffer.AccountName = buyer, seller
+	return newSwapTrade(id, match, time.Hour)
+}
+
+func findTradeLocked(s *Service, accountName string, tradeID string) (*Trade, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.findTrade(accountName, tradeID)
+}
+
+func TestFindTrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, _ := newTestService(t, "http://127.0.0.1:1", dir)
+
+	bought := testSwapTrade("bought", "alice", "bob")
+	sold := testSwapTrade("sold", "carol", "alice")
+	s.mu.Lock()
+	s.indexTrade(bought)
+	s.indexTrade(sold)
+	s.mu.Unlock()
+
+	if _, _, err := findTradeLocked(s, "alice", ""); err != errAmbiguousTrade {
+		t.Fatalf("trades on both sides: error = %v, want %v", err, errAmbiguousTrade)
+	}
+
+	trade, role, err := findTradeLocked(s, "alice", "sold")
+	if err != nil || trade != sold || role != TradeRoleSeller {
+		t.Fatalf("by id: trade = %v, role = %q, error = %v, want the sold trade as seller", trade, role, err)
+	}
+
+	if _, _, err := findTradeLocked(s, "bob", "sold"); err != errNoTrade {
+		t.Fatalf("trade of other accounts: error = %v, want %v", err, errNoTrade)
+	}
+
+	s.setTradeState(bought, TradeStateCompleted)
+
+	trade, role, err = findTradeLocked(s, "alice", "")
+	if err != nil || trade != sold || role != TradeRoleSeller {
+		t.Fatalf("after the buy trade finished: trade = %v, role = %q, error = %v, want the sold trade as seller", trade, role, err)
+	}
+
+	if _, _, err := findTradeLocked(s, "bob", ""); err != errNoTrade {
+		t.Fatalf("finished trade without id: error = %v, want %v", err, errNoTrade)
+	}
+
+	trade, role, err = findTradeLocked(s, "alice", "bought")
+	if err != nil || trade != bought || role != TradeRoleBuyer {
+		t.Fatalf("finished trade by id: trade = %v, role = %q, error = %v, want the bought trade as buyer", trade, role, err)
+	}
+}
@@ -2,9 +2,15 @@ package server
 
 import (
 	"bisq-add-on/api"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"go.uber.org/zap"
+	"math"
 	"net/http"
+	"sort"
+	"time"
 )
 
 func handleSimpleResponse(w http.ResponseWriter, status int, msg string) {
@@ -12,8 +18,153 @@ func handleSimpleResponse(w http.ResponseWriter, status int, msg string) {
 	_, _ = w.Write([]byte(msg))
 }
 
-func (s *Service) matchOffers(offer *UserOffer) (bool, error) {
-	s.logger.Info("server.utils.matchOffers: searching for match offer...")
+func handleJSONResponse(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		handleSimpleResponse(w, http.StatusInternalServerError, "json marshal failure.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// normalizeOffer fills defaults and rejects offers that can not be matched.
+func normalizeOffer(offer *UserOffer, markets marketRegistry) error {
+	_, err := markets.market(offer.Token)
+	if err != nil {
+		return err
+	}
+
+	if offer.Settlement == "" {
+		offer.Settlement = SettlementBisq
+	}
+
+	if offer.PriceType == "" {
+		offer.PriceType = PriceTypeFixed
+	}
+
+	switch offer.PriceType {
+	case PriceTypeFixed:
+		if offer.MarketMargin != 0 {
+			return errors.New("'marketMargin' is only allowed for market-based prices")
+		}
+		if offer.Price.Sign() <= 0 {
+			return errors.New("'price' must be positive")
+		}
+		if _, err = offer.Price.Units(priceDecimals); err != nil {
+			return fmt.Errorf("'price' can have at most %d decimals", priceDecimals)
+		}
+	case PriceTypeMarket:
+		if !offer.Price.IsZero() {
+			return errors.New("'price' is not allowed for market-based prices")
+		}
+		if math.IsNaN(offer.MarketMargin) || math.Abs(offer.MarketMargin) > maxMarketMargin {
+			return fmt.Errorf("'marketMargin' must be between -%d%% and %d%%", maxMarketMargin, maxMarketMargin)
+		}
+	default:
+		return errors.New("unknown price type " + offer.PriceType)
+	}
+
+	if offer.Amount.Sign() <= 0 {
+		return errors.New("'amount' must be positive")
+	}
+
+	if offer.MinReputation < 0 {
+		return errors.New("'minReputation' can not be negative")
+	}
+
+	switch offer.Settlement {
+	case SettlementBisq:
+		if offer.CounterToken != "" {
+			return errors.New("'counterToken' is only allowed for token swaps")
+		}
+		if _, err = offer.Amount.Units(btcDecimals); err != nil {
+			return fmt.Errorf("'amount' can have at most %d decimals", btcDecimals)
+		}
+	case SettlementTokenSwap:
+		if offer.CounterToken == "" {
+			return errors.New("'counterToken' is missing")
+		}
+		counterMarket, err := markets.market(offer.CounterToken)
+		if err != nil {
+			return err
+		}
+		if _, err = offer.Amount.Units(counterMarket.Decimals); err != nil {
+			return fmt.Errorf("'amount' can have at most %d decimals", counterMarket.Decimals)
+		}
+	default:
+		return errors.New("unknown settlement " + offer.Settlement)
+	}
+
+	return nil
+}
+
+// restingOffer is an offer of the book taken as a match candidate.
+type restingOffer struct {
+	account string
+	offer   *UserOffer
+}
+
+// candidateOffers copies the offers of book the offer could trade with, oldest first.
+// Book may change once the lock is released, the chosen offer is claimed with claimOffer.
+func (s *Service) candidateOffers(offer *UserOffer, book map[string]*UserOffer) []restingOffer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var candidates []restingOffer
+	for account, savedOffer := range book {
+		if savedOffer.Token == offer.Token && savedOffer.Amount.Cmp(offer.Amount) == 0 &&
+			savedOffer.Settlement == offer.Settlement && savedOffer.CounterToken == offer.CounterToken {
+			candidates = append(candidates, restingOffer{account: account, offer: savedOffer})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].offer.createdAt.Before(candidates[j].offer.createdAt)
+	})
+	return candidates
+}
+
+// claimOffer removes the resting offer from book, false when it was matched, cancelled or replaced meanwhile.
+func (s *Service) claimOffer(book map[string]*UserOffer, account string, resting *UserOffer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if book[account] != resting {
+		return false
+	}
+	delete(book, account)
+	return true
+}
+
+// restoreOffer puts a claimed offer back after its settlement failed,
+// unless the account placed a new one or was suspended meanwhile.
+func (s *Service) restoreOffer(book map[string]*UserOffer, account string, resting *UserOffer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := book[account]; !ok && !s.isSuspended(account) {
+		book[account] = resting
+	}
+}
+
+// matchOffers looks for a resting offer on the other side that crosses the offer.
+// Trade is executed at the price of the resting offer.
+func (s *Service) matchOffers(ctx context.Context, offer *UserOffer) (bool, error) {
+	s.log(ctx).Info("server.utils.matchOffers: searching for match offer...")
+
+	price, err := s.offerPrice(ctx, offer)
+	if err != nil {
+		s.log(ctx).Error("server.utils.matchOffers: server.offerPrice failure.")
+		return false, err
+	}
+
+	market, err := s.markets.market(offer.Token)
+	if err != nil {
+		s.log(ctx).Error("server.utils.matchOffers: market lookup failure.", zap.Error(err))
+		return false, err
+	}
 
 	offers := s.buyOffers
 
@@ -21,168 +172,308 @@ func (s *Service) matchOffers(offer *UserOffer) (bool, error) {
 		offers = s.sellOffers
 	}
 
-	for account, savedOffer := range offers {
-		if account != offer.AccountName {
-			if savedOffer.Token == offer.Token && savedOffer.Amount == offer.Amount && savedOffer.Price == offer.Price {
-				s.logger.Info("server.utils.matchOffers: found offer to match.")
+	for _, candidate := range s.candidateOffers(offer, offers) {
+		account, savedOffer := candidate.account, candidate.offer
+		link := selfTradeLink(offer, savedOffer)
 
-				buyOffer := savedOffer
-				sellOffer := offer
-				if offer.Direction == "BUY" {
-					buyOffer, sellOffer = sellOffer, buyOffer
-				}
+		s.mu.Lock()
+		accepted := link != "" || s.meetsReputation(offer, savedOffer)
+		s.mu.Unlock()
+		if !accepted {
+			continue
+		}
 
-				err := s.handleMatchedOffers(buyOffer, sellOffer)
-				if err != nil {
-					s.logger.Error("server.utils.matchOffer: server.handleMatchedOffers failure.")
-					return false, err
-				}
+		savedPrice, err := s.offerPrice(ctx, savedOffer)
+		if err != nil {
+			s.log(ctx).Error("server.utils.matchOffers: server.offerPrice failure.", zap.Error(err))
+			continue
+		}
 
-				s.logger.Info("server.utils.matchOffers: matched offers successfully.")
+		buyOffer, buyPrice := savedOffer, savedPrice
+		sellOffer, sellPrice := offer, price
+		if offer.Direction == "BUY" {
+			buyOffer, sellOffer = sellOffer, buyOffer
+			buyPrice, sellPrice = sellPrice, buyPrice
+		}
+
+		if buyPrice.Cmp(sellPrice) < 0 {
+			continue
+		}
 
-				return true, nil
+		if link != "" {
+			if s.preventSelfTrade(ctx, offer, savedOffer, offers, account, link) {
+				return false, errSelfTrade
 			}
+			continue
+		}
+
+		// market could have moved away from the resting offer since it was placed.
+		err = s.checkDeviation(ctx, offer.Token, savedPrice)
+		if err != nil {
+			s.log(ctx).Info("server.utils.matchOffers: resting offer price is off the market.", zap.Error(err))
+			continue
+		}
+
+		// another request could have matched or cancelled the resting offer meanwhile.
+		if !s.claimOffer(offers, account, savedOffer) {
+			continue
 		}
+
+		s.log(ctx).Info("server.utils.matchOffers: found offer to match.")
+
+		match := Match{
+			BuyOffer:    buyOffer,
+			SellOffer:   sellOffer,
+			Price:       savedPrice,
+			TokenAmount: tokenAmount(savedPrice, offer.Amount, market.Decimals),
+			Maker:       TradeRoleBuyer,
+		}
+		if savedOffer == sellOffer {
+			match.Maker = TradeRoleSeller
+		}
+
+		pending := false
+		switch {
+		case offer.Settlement == SettlementTokenSwap:
+			err = s.handleMatchedSwap(ctx, &match)
+		case s.bisqAvailable():
+			err = s.handleMatchedOffers(ctx, &match)
+			if err != nil && s.settlementDeferred(err) {
+				// bisq went down during settlement, the queue resumes it from the published offer.
+				s.queueSettlement(ctx, &match)
+				pending, err = true, nil
+			}
+		default:
+			s.queueSettlement(ctx, &match)
+			pending = true
+		}
+		if err != nil {
+			s.log(ctx).Error("server.utils.matchOffer: handling matched offers failure.")
+			s.abandonMatch(ctx, &match)
+			s.restoreOffer(offers, account, savedOffer)
+			return false, err
+		}
+
+		s.metrics.matches.WithLabelValues(offer.Token, offer.Settlement).Inc()
+		s.metrics.timeToMatch.WithLabelValues(offer.Token).Observe(time.Since(savedOffer.createdAt).Seconds())
+
+		if pending {
+			return true, errSettlementPending
+		}
+
+		s.log(ctx).Info("server.utils.matchOffers: matched offers successfully.")
+
+		return true, nil
 	}
 
-	s.logger.Info("server.utils.matchOffers: no offers to match was found.")
+	s.log(ctx).Info("server.utils.matchOffers: no offers to match was found.")
 	return false, nil
 }
 
-func (s *Service) handleMatchedOffers(buyOffer *UserOffer, sellOffer *UserOffer) error {
-	s.logger.Info("server.utils.handleMatchedOffers: new incoming offers...")
+func (s *Service) handleMatchedOffers(ctx context.Context, match *Match) error {
+	s.log(ctx).Info("server.utils.handleMatchedOffers: new incoming offers...")
 
-	s.mu.Lock()
-	s.matchedBuyAccounts[sellOffer.AccountName] = buyOffer.AccountName
-	s.matchedSellAccounts[buyOffer.AccountName] = sellOffer.AccountName
-	s.mu.Unlock()
+	finish := s.startSettlement("handleMatchedOffers", "", match)
+	defer finish()
 
-	buyAccount := api.PaymentAccount{
-		Name:                  buyOffer.AccountName,
-		TradeCurrencies:       []string{"BTC", "ETH"},
-		PaymentMethod:         "BLOCK_CHAINS",
-		ID:                    "",
-		Details:               buyOffer.EthereumWallet,
-		SelectedTradeCurrency: "ETH",
-	}
+	buyOffer, sellOffer := match.BuyOffer, match.SellOffer
 
-	respBuyAcc, err := api.RegisterPaymentAccounts(s.logger, s.client, &buyAccount)
+	market, err := s.markets.market(buyOffer.Token)
 	if err != nil {
-		s.logger.Error("server.utils.handleMatchedOffers: api.RegisterPaymentAccounts failure.")
+		s.log(ctx).Error("server.utils.handleMatchedOffers: market lookup failure.", zap.Error(err))
 		return err
 	}
 
-	s.logger.Info("server.utils.handleMatchedOffers: buy account parsed successfully.")
+	// bisq takes BTC amounts as integers.
+	amount, err := buyOffer.Amount.Int64Units(btcDecimals)
+	if err != nil {
+		s.log(ctx).Error("server.utils.handleMatchedOffers: amount conversion failure.", zap.Error(err))
+		return err
+	}
 
 	s.mu.Lock()
-	s.accounts[respBuyAcc.Name] = respBuyAcc
-	s.ethereumWallets[respBuyAcc.Name] = respBuyAcc.Details
+	offerID := match.BisqOfferID
 	s.mu.Unlock()
 
-	offerToCreate := api.OfferToCreate{
-		FundUsingBisqWallet:       true,
-		OfferID:                   "",
-		AccountID:                 respBuyAcc.ID,
-		Direction:                 "BUY",
-		PriceType:                 "",
-		MarketPair:                "btc_eth",
-		PercentageFromMarketPrice: 0,
-		FixedPrice:                buyOffer.Price,
-		Amount:                    buyOffer.Amount,
-		MinAmount:                 buyOffer.Amount,
-		BuyerSecurityDeposit:      1,
+	if offerID == "" {
+		offerID, err = s.publishMatchOffer(ctx, match, market, amount)
+		if err != nil {
+			return err
+		}
+	} else {
+		s.log(ctx).Info("server.utils.handleMatchedOffers: resuming with published buy offer.", zap.String("offerId", offerID))
 	}
+	addLogFields(ctx, zap.String("offerId", offerID))
 
-	offerDetails, err := api.PublishOffer(s.logger, s.client, &offerToCreate)
+	respSellAcc, err := s.paymentAccount(ctx, sellOffer.AccountName, market, sellOffer.EthereumWallet)
 	if err != nil {
-		s.logger.Error("server.utils.handleMatchedOffers: api.PublishOffer failure.")
+		s.log(ctx).Error("server.utils.handleMatchedOffers: server.paymentAccount failure.")
 		return err
 	}
 
-	s.logger.Info("server.utils.handleMatchedOffers: published buy offer successfully.")
+	s.log(ctx).Info("server.utils.handleMatchedOffers: sell account resolved successfully.")
 
-	sellAccount := api.PaymentAccount{
-		Name:                  sellOffer.AccountName,
-		TradeCurrencies:       []string{"BTC", "ETH"},
-		PaymentMethod:         "BLOCK_CHAINS",
-		ID:                    "",
-		Details:               sellOffer.EthereumWallet,
-		SelectedTradeCurrency: "ETH",
+	offerToTake := api.OfferToTake{
+		OfferID:          offerID,
+		PaymentAccountID: respSellAcc.ID,
+		Amount:           amount,
 	}
 
-	respSellAcc, err := api.RegisterPaymentAccounts(s.logger, s.client, &sellAccount)
+	tradeDetails, err := api.TakeOffer(ctx, s.logger, s.client, &offerToTake)
+	s.auditCall(offerToTake.OfferID, "TakeOffer", &offerToTake, err)
 	if err != nil {
-		s.logger.Error("server.utils.handleMatchedOffers: api.RegisterPaymentAccounts failure.")
+		s.log(ctx).Error("server.utils.handleMatchedOffers: api.TakeOffer failure.")
 		return err
 	}
 
-	s.logger.Info("server.utils.handleMatchedOffers: sell account parsed successfully.")
+	s.log(ctx).Info("server.utils.handleMatchedOffers: took buy order successfully.")
 
-	s.mu.Lock()
-	s.accounts[respSellAcc.Name] = respSellAcc
-	s.ethereumWallets[respSellAcc.Name] = respSellAcc.Details
-	s.mu.Unlock()
-
-	offerToTake := api.OfferToTake{
-		PaymentAccountID: respSellAcc.ID,
-		Amount:           offerToCreate.Amount,
-	}
+	trade := newTrade(match, tradeDetails)
+	addLogFields(ctx, zap.String("tradeId", trade.ID))
 
-	tradeDetails, err := api.TakeOffer(s.logger, s.client, &offerToTake)
+	err = s.chargeFees(trade, match)
 	if err != nil {
-		s.logger.Error("server.utils.handleMatchedOffers: api.TakeOffer failure.")
+		s.log(ctx).Error("server.utils.handleMatchedOffers: server.chargeFees failure.")
 		return err
 	}
 
-	s.logger.Info("server.utils.handleMatchedOffers: took buy order successfully.")
-
 	s.mu.Lock()
-	s.buyTrades[respBuyAcc.Name] = tradeDetails
-	s.sellTrades[respSellAcc.Name] = tradeDetails
+	s.indexTrade(trade)
 	s.mu.Unlock()
 
+	s.auditMatch(trade, match, "bisq.PublishOffer", "bisq.TakeOffer")
+
 	return nil
 }
 
-func (s *Service) checkTransaction(transactionID string, buySide string, sellSide string) (bool, error) {
-	s.logger.Info("server.utils.checkTransaction: new incoming transaction...")
+// publishMatchOffer publishes the Bisq buy offer of the match at the match price
+// and saves its id on the match, so a retried settlement takes it instead of publishing another one.
+// Bisq offer is always fixed-price, also for market-based offers: those are priced by the oracle
+// when matched, Bisq would price them off its own feed.
+func (s *Service) publishMatchOffer(ctx context.Context, match *Match, market *Market, amount int64) (string, error) {
+	buyOffer := match.BuyOffer
 
-	transactionInfo, err := api.GetTxInfo(s.logger, s.client, transactionID)
+	respBuyAcc, err := s.paymentAccount(ctx, buyOffer.AccountName, market, buyOffer.EthereumWallet)
 	if err != nil {
-		return true, err
+		s.log(ctx).Error("server.utils.publishMatchOffer: server.paymentAccount failure.")
+		return "", err
 	}
 
-	if !transactionInfo.Success {
-		return false, errors.New("transaction did not complete successfully")
+	s.log(ctx).Info("server.utils.publishMatchOffer: buy account resolved successfully.")
+
+	// bisq takes prices as integers.
+	fixedPrice, err := match.Price.Int64Units(priceDecimals)
+	if err != nil {
+		s.log(ctx).Error("server.utils.publishMatchOffer: price conversion failure.", zap.Error(err))
+		return "", err
 	}
 
-	fromAddr := s.ethereumWallets[buySide]
-	toAddr := s.ethereumWallets[sellSide]
+	deposit, err := s.securityDeposit(market, buyOffer.AccountName, buyOffer.Amount)
+	if err != nil {
+		s.log(ctx).Error("server.utils.publishMatchOffer: server.securityDeposit failure.", zap.Error(err))
+		return "", err
+	}
 
-	if transactionInfo.From != fromAddr {
-		return false, errors.New("transaction sender address is incorrect")
+	depositAmount, err := deposit.Amount.Int64Units(btcDecimals)
+	if err != nil {
+		s.log(ctx).Error("server.utils.publishMatchOffer: deposit conversion failure.", zap.Error(err))
+		return "", err
 	}
 
-	if transactionInfo.To != toAddr {
-		return false, errors.New("transaction receiver address is incorrect")
+	offerToCreate := api.OfferToCreate{
+		FundUsingBisqWallet:       true,
+		OfferID:                   "",
+		AccountID:                 respBuyAcc.ID,
+		Direction:                 "BUY",
+		PriceType:                 PriceTypeFixed,
+		MarketPair:                market.MarketPair,
+		PercentageFromMarketPrice: 0,
+		FixedPrice:                fixedPrice,
+		Amount:                    amount,
+		MinAmount:                 amount,
+		BuyerSecurityDeposit:      depositAmount,
+	}
+
+	offerDetails, err := api.PublishOffer(ctx, s.logger, s.client, &offerToCreate)
+	if err != nil {
+		s.auditCall("", "PublishOffer", &offerToCreate, err)
+		s.log(ctx).Error("server.utils.publishMatchOffer: api.PublishOffer failure.")
+		return "", err
+	}
+
+	s.auditCall(offerDetails.ID, "PublishOffer", &offerToCreate, nil)
+	s.log(ctx).Info("server.utils.publishMatchOffer: published buy offer successfully.", zap.String("offerId", offerDetails.ID))
+
+	s.mu.Lock()
+	s.publishedOffers[offerDetails.ID] = buyOffer.AccountName
+	match.BisqOfferID = offerDetails.ID
+	s.mu.Unlock()
+
+	return offerDetails.ID, nil
+}
+
+// abandonMatch removes the Bisq offer published for a match whose settlement will not be retried.
+// Offer that can not be removed is left to reconciliation, which reports it as orphaned.
+func (s *Service) abandonMatch(ctx context.Context, match *Match) {
+	s.mu.Lock()
+	offerID := match.BisqOfferID
+	s.mu.Unlock()
+
+	if offerID == "" {
+		return
 	}
 
-	return true, nil
+	err := api.RemoveOffer(ctx, s.logger, s.client, offerID)
+	s.auditCall(offerID, "RemoveOffer", offerID, err)
+	if err != nil {
+		s.log(ctx).Error("server.utils.abandonMatch: api.RemoveOffer failure.", zap.String("offerId", offerID), zap.Error(err))
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.publishedOffers, offerID)
+	match.BisqOfferID = ""
+	s.mu.Unlock()
+
+	s.log(ctx).Info("server.utils.abandonMatch: removed published buy offer.", zap.String("offerId", offerID))
 }
 
-func (s *Service) handleSuccessfulTransaction(trade *api.TradeDetails) error {
-	s.logger.Info("server.utils.handleSuccessfulTransaction: new incoming trade...")
-	err := api.PaymentStarted(s.logger, s.client, trade)
+func (s *Service) handleSuccessfulTransaction(ctx context.Context, trade *Trade) error {
+	s.log(ctx).Info("server.utils.handleSuccessfulTransaction: new incoming trade...")
+
+	details := s.tradeDetails(trade)
+	finish := s.startSettlement("handleSuccessfulTransaction", trade.ID, details.ID)
+	defer finish()
+
+	err := api.PaymentStarted(ctx, s.logger, s.client, details)
+	s.auditCall(trade.ID, "PaymentStarted", details.ID, err)
+	if err != nil {
+		s.log(ctx).Error("server.utils.handleSuccessfulTransaction: api.PaymentStarted failure.")
+		return err
+	}
+
+	err = api.PaymentReceived(ctx, s.logger, s.client, details)
+	s.auditCall(trade.ID, "PaymentReceived", details.ID, err)
 	if err != nil {
-		s.logger.Error("server.utils.handleSuccessfulTransaction: api.PaymentStarted failure.")
+		s.log(ctx).Error("server.utils.handleSuccessfulTransaction: api.PaymentReceived failure.")
 		return err
 	}
 
-	err = api.PaymentReceived(s.logger, s.client, trade)
+	return nil
+}
+
+// confirmPayment confirms Bisq payment of the trade claimed by confirmLeg or claimPayment and completes the trade.
+// Trade that left PAYMENT_SENT meanwhile, e.g. forced by an operator, is not completed.
+func (s *Service) confirmPayment(ctx context.Context, trade *Trade, principal string, reason string) error {
+	defer s.releasePayment(trade)
+
+	err := s.handleSuccessfulTransaction(ctx, trade)
 	if err != nil {
-		s.logger.Error("server.utils.handleSuccessfulTransaction: api.PaymentReceived failure.")
 		return err
 	}
 
+	if !s.transitionTradeFrom(trade, TradeStatePaymentSent, TradeStateCompleted, principal, reason) {
+		s.log(ctx).Warn("server.utils.confirmPayment: trade left PAYMENT_SENT during payment confirmation.")
+	}
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/decred/dcrd/dcrec/secp256k1/v3/ecdsa"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/sha3"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	challengeNonceLength = 16
+	challengeTTL         = 5 * time.Minute
+)
+
+var (
+	ethereumAddressRegexp = regexp.MustCompile("^0x[0-9a-fA-F]{40}$")
+
+	errInvalidWallet      = errors.New("invalid ethereum wallet address")
+	errInvalidSignature   = errors.New("invalid signature")
+	errChallengeNotFound  = errors.New("challenge not found")
+	errChallengeExpired   = errors.New("challenge expired")
+	errSignatureMismatch  = errors.New("signature does not match wallet")
+	errWalletAlreadyBound = errors.New("wallet is bound to another account")
+)
+
+// WalletChallenge is a single-use nonce the account has to sign with
+// the wallet's private key to prove ownership of the wallet.
+type WalletChallenge struct {
+	AccountName    string    `json:"accountName"`
+	EthereumWallet string    `json:"ethereumWallet"`
+	Nonce          string    `json:"nonce"`
+	Message        string    `json:"message"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+}
+
+type WalletChallengeRequest struct {
+	EthereumWallet string `json:"ethereumWallet"`
+}
+
+type WalletVerifyRequest struct {
+	EthereumWallet string `json:"ethereumWallet"`
+	Signature      string `json:"signature"`
+}
+
+func normalizeWallet(wallet string) (string, error) {
+	if !ethereumAddressRegexp.MatchString(wallet) {
+		return "", errInvalidWallet
+	}
+	return strings.ToLower(wallet), nil
+}
+
+func challengeMessage(accountName string, wallet string, nonce string) string {
+	return fmt.Sprintf(
+		"bisq-add-on wallet verification\nAccount: %s\nWallet: %s\nNonce: %s",
+		accountName, wallet, nonce,
+	)
+}
+
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		_, _ = h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// personalSignHash returns the EIP-191 hash signed by personal_sign.
+func personalSignHash(message string) []byte {
+	prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d", len(message))
+	return keccak256([]byte(prefix), []byte(message))
+}
+
+// recoverAddress returns the lower-cased address of the key that produced
+// the 65 byte [R || S || V] signature over the personal_sign message.
+func recoverAddress(message string, signature string) (string, error) {
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, "0x"))
+	if err != nil || len(sig) != 65 {
+		return "", errInvalidSignature
+	}
+
+	v := sig[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 {
+		return "", errInvalidSignature
+	}
+
+	// decred compact format is [27 + recovery id || R || S].
+	compact := make([]byte, 65)
+	compact[0] = 27 + v
+	copy(compact[1:], sig[:64])
+
+	pubKey, _, err := ecdsa.RecoverCompact(compact, personalSignHash(message))
+	if err != nil {
+		return "", errInvalidSignature
+	}
+
+	uncompressed := pubKey.SerializeUncompressed()
+	address := keccak256(uncompressed[1:])[12:]
+
+	return "0x" + hex.EncodeToString(address), nil
+}
+
+// isWalletVerified reports whether the wallet was bound to the account by signature.
+// Caller must hold s.mu.
+func (s *Service) isWalletVerified(accountName string, wallet string) bool {
+	return s.walletOwners[strings.ToLower(wallet)] == accountName
+}
+
+func (s *Service) WalletChallengeHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.wallet.WalletChallengeHandle: received new request.")
+
+	principal, ok := s.requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var req WalletChallengeRequest
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(&req)
+	if err != nil {
+		s.log(ctx).Error("server.wallet.WalletChallengeHandle: json decoder failure.", zap.Error(err))
+		decoderFailure(w, err, http.StatusInternalServerError, "json decoder failure.")
+		return
+	}
+
+	wallet, err := normalizeWallet(req.EthereumWallet)
+	if err != nil {
+		s.log(ctx).Info("server.wallet.WalletChallengeHandle: invalid wallet.", zap.String("wallet", req.EthereumWallet))
+		handleSimpleResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	buf := make([]byte, challengeNonceLength)
+	_, err = rand.Read(buf)
+	if err != nil {
+		s.log(ctx).Error("server.wallet.WalletChallengeHandle: generating nonce failure.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusInternalServerError, "generating nonce failure.")
+		return
+	}
+	nonce := hex.EncodeToString(buf)
+
+	challenge := WalletChallenge{
+		AccountName:    principal,
+		EthereumWallet: wallet,
+		Nonce:          nonce,
+		Message:        challengeMessage(principal, wallet, nonce),
+		ExpiresAt:      time.Now().Add(challengeTTL),
+	}
+
+	s.mu.Lock()
+	s.walletChallenges[principal] = &challenge
+	s.mu.Unlock()
+
+	s.log(ctx).Info("server.wallet.WalletChallengeHandle: challenge issued.", zap.String("account", principal))
+	handleJSONResponse(w, http.StatusOK, &challenge)
+}
+
+func (s *Service) WalletVerifyHandle(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	s.log(ctx).Info("server.wallet.WalletVerifyHandle: received new request.")
+
+	principal, ok := s.requirePrincipal(w, r)
+	if !ok {
+		return
+	}
+
+	var req WalletVerifyRequest
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(&req)
+	if err != nil {
+		s.log(ctx).Error("server.wallet.WalletVerifyHandle: json decoder failure.", zap.Error(err))
+		decoderFailure(w, err, http.StatusInternalServerError, "json decoder failure.")
+		return
+	}
+
+	wallet, err := normalizeWallet(req.EthereumWallet)
+	if err != nil {
+		s.log(ctx).Info("server.wallet.WalletVerifyHandle: invalid wallet.", zap.String("wallet", req.EthereumWallet))
+		handleSimpleResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// challenge is single-use, so it is dropped whatever the outcome.
+	s.mu.Lock()
+	challenge, ok := s.walletChallenges[principal]
+	delete(s.walletChallenges, principal)
+	s.mu.Unlock()
+
+	if !ok || challenge.EthereumWallet != wallet {
+		s.log(ctx).Info("server.wallet.WalletVerifyHandle: challenge not found.", zap.String("account", principal))
+		handleSimpleResponse(w, http.StatusBadRequest, errChallengeNotFound.Error())
+		return
+	}
+
+	if time.Now().After(challenge.ExpiresAt) {
+		s.log(ctx).Info("server.wallet.WalletVerifyHandle: challenge expired.", zap.String("account", principal))
+		handleSimpleResponse(w, http.StatusBadRequest, errChallengeExpired.Error())
+		return
+	}
+
+	recovered, err := recoverAddress(challenge.Message, req.Signature)
+	if err != nil {
+		s.log(ctx).Info("server.wallet.WalletVerifyHandle: signature recovery failure.", zap.Error(err))
+		handleSimpleResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if recovered != wallet {
+		s.log(ctx).Info(
+			"server.wallet.WalletVerifyHandle: signature does not match wallet.",
+			zap.String("wallet", wallet),
+			zap.String("recovered", recovered),
+		)
+		handleSimpleResponse(w, http.StatusForbidden, errSignatureMismatch.Error())
+		return
+	}
+
+	s.mu.Lock()
+	owner, bound := s.walletOwners[wallet]
+	if bound && owner != principal {
+		s.mu.Unlock()
+		s.log(ctx).Info("server.wallet.WalletVerifyHandle: wallet is bound to another account.", zap.String("wallet", wallet))
+		handleSimpleResponse(w, http.StatusConflict, errWalletAlreadyBound.Error())
+		return
+	}
+	s.walletOwners[wallet] = principal
+	s.mu.Unlock()
+
+	s.audit(principal, AuditWalletVerify, "", &req, "VERIFIED")
+
+	s.log(ctx).Info(
+		"server.wallet.WalletVerifyHandle: wallet verified successfully.",
+		zap.String("account", principal),
+		zap.String("wallet", wallet),
+	)
+	handleSimpleResponse(w, http.StatusOK, "wallet verified successfully.")
+}